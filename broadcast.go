@@ -0,0 +1,234 @@
+package tjob
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// most bytes of the latest logs kept in memory for followers, dropping the
+// oldest half at once beyond twice as many
+const broadcastTail = 1 << 20
+
+// errBehind reading at an offset before the logs kept in memory
+var errBehind = errors.New("behind logs kept")
+
+// LogBroadcaster reads the logs of a job once for all of its followers instead
+// of each watching the log files, keeping the latest in memory to fan out
+type LogBroadcaster struct {
+	cancel context.CancelFunc
+	path   string
+	doner  Doner
+
+	mu     sync.Mutex
+	subs   int
+	closed bool
+	done   bool
+	err    error
+
+	// latest logs at start in all logs ever written
+	buf   []byte
+	start int64
+
+	// closed once more logs or done
+	changed chan struct{}
+}
+
+// NewLogBroadcaster returns the LogBroadcaster of the logs at filename,
+// including any older segments rotated, from their end until the Job stops.
+// It closes once the last of its subscribers closes.
+func NewLogBroadcaster(filename string, doner Doner) (*LogBroadcaster, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := newJobReader(ctx, filename, doner, true)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	start, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		r.Close()
+		cancel()
+		return nil, err
+	}
+	b := &LogBroadcaster{
+		cancel:  cancel,
+		path:    filename,
+		doner:   doner,
+		start:   start,
+		changed: make(chan struct{}),
+	}
+	go b.run(r)
+	return b, nil
+}
+
+// run reads the logs into memory waking all subscribers until the Job stops
+func (b *LogBroadcaster) run(r *JobReader) {
+	defer r.Close()
+
+	buffer := make([]byte, logBuffer)
+	for {
+		n, err := r.Read(buffer)
+		b.mu.Lock()
+		if n > 0 && !b.closed {
+			b.append(r.Offset()-int64(n), buffer[:n])
+		}
+		if err != nil {
+			b.done = true
+			if !errors.Is(err, io.EOF) {
+				b.err = fmt.Errorf("broadcast: %w", err)
+			}
+		}
+		close(b.changed)
+		b.changed = make(chan struct{})
+		b.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// append keeps the output read at the offset, starting over past any gap of
+// logs dropped before read
+func (b *LogBroadcaster) append(offset int64, out []byte) {
+	if offset != b.start+int64(len(b.buf)) {
+		b.buf, b.start = b.buf[:0], offset
+	}
+	b.buf = append(b.buf, out...)
+	if len(b.buf) > 2*broadcastTail {
+		drop := len(b.buf) - broadcastTail
+		b.buf = b.buf[:copy(b.buf, b.buf[drop:])]
+		b.start += int64(drop)
+	}
+}
+
+// Subscribe returns the JobReader following the logs from the offset in all
+// logs ever written until the Job stops, reading any logs before those kept in
+// memory from the log files. Its Close unsubscribes it.
+func (b *LogBroadcaster) Subscribe(ctx context.Context, offset int64) (*JobReader, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, fmt.Errorf("subscribe: %w", os.ErrClosed)
+	}
+	b.subs++
+	return &JobReader{
+		ctx:    ctx,
+		doner:  b.doner,
+		path:   b.path,
+		hub:    b,
+		offset: offset,
+		leave:  sync.OnceFunc(b.leave),
+	}, nil
+}
+
+// leave closes the broadcaster once its last subscriber leaves
+func (b *LogBroadcaster) leave() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs--; b.subs == 0 {
+		b.close()
+	}
+}
+
+// Close stops reading the logs, ending those of any subscribers left
+func (b *LogBroadcaster) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.close()
+	return nil
+}
+
+func (b *LogBroadcaster) close() {
+	if !b.closed {
+		b.closed = true
+		b.cancel()
+		b.buf = nil
+	}
+}
+
+// readAt copies the logs kept in memory at the offset. Otherwise it returns
+// the channel closed once more unless done, or errBehind if before those kept.
+func (b *LogBroadcaster) readAt(p []byte, offset int64) (int, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	end := b.start + int64(len(b.buf))
+	switch {
+	case offset < b.start:
+		return 0, nil, errBehind
+	case offset < end:
+		return copy(p, b.buf[offset-b.start:]), nil, nil
+	case b.done:
+		return 0, nil, cmp.Or(b.err, io.EOF)
+	}
+	return 0, b.changed, nil
+}
+
+// first returns the offset of the logs kept in memory
+func (b *LogBroadcaster) first() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.start
+}
+
+// readHub reads the logs kept in memory by the broadcaster, or the segments
+// for any before, waiting for more until the Job stops
+func (r *JobReader) readHub(buffer []byte) (int, error) {
+	for r.ctx.Err() == nil {
+		n, changed, err := r.hub.readAt(buffer, r.offset)
+		switch {
+		case errors.Is(err, errBehind):
+			if n, err = r.readOlder(buffer); n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		case err != nil:
+			return 0, err
+		case n > 0:
+			r.offset += int64(n)
+			r.closeLogs()
+			return n, nil
+		}
+		select {
+		case <-changed:
+		case <-r.ctx.Done():
+		}
+	}
+	return 0, io.EOF
+}
+
+// readOlder reads the segments at the offset before the logs kept in memory
+// by the broadcaster, skipping to those kept once no more
+func (r *JobReader) readOlder(buffer []byte) (int, error) {
+	if r.logs == nil {
+		if _, err := r.Seek(r.offset, io.SeekStart); err != nil {
+			if r.ctx.Err() != nil {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+	}
+	n, err := r.readFile(buffer)
+	r.offset = r.fileOffset()
+	if errors.Is(err, io.EOF) {
+		if n == 0 {
+			r.offset = max(r.offset, r.hub.first())
+			r.closeLogs()
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// closeLogs closes the segment read unless none
+func (r *JobReader) closeLogs() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.logs != nil {
+		r.logs.Close()
+		r.logs = nil
+	}
+}
@@ -0,0 +1,190 @@
+package tjob_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob"
+)
+
+func TestLogBroadcaster(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "output.log")
+	tmp, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unexpected log file: %v", err)
+	}
+	defer func() { tmp.Close() }()
+	_, _ = tmp.WriteString("Hello")
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+
+	job := JobMock{}
+	sut, err := tjob.NewLogBroadcaster(path, &job)
+	if err != nil {
+		t.Fatalf("unexpected broadcaster: %v", err)
+	}
+	// followers from before the logs kept in memory and from their end
+	tests := []struct {
+		offset int64
+		out    string
+	}{
+		{0, "HelloWorld"},
+		{5, "World"},
+	}
+	subs := make([]*tjob.JobReader, len(tests))
+	for i, test := range tests {
+		if subs[i], err = sut.Subscribe(ctx, test.offset); err != nil {
+			t.Fatalf("unexpected subscribe: %v", err)
+		}
+	}
+	go func() {
+		<-time.After(100 * time.Millisecond)
+		_, _ = tmp.WriteString("World")
+		_ = job.SetDone()
+		// wake followers once stopped as the job does
+		tmp.Close()
+	}()
+	for i, test := range tests {
+		out, err := io.ReadAll(subs[i])
+		if err != nil {
+			t.Fatalf("unexpected read: %v", err)
+		}
+		if string(out) != test.out {
+			t.Errorf("expected out(%s) == %s", out, test.out)
+		}
+		if offset := subs[i].Offset(); offset != 10 {
+			t.Errorf("expected offset(%d) == 10", offset)
+		}
+	}
+
+	// closed once the last subscriber left
+	for _, sub := range subs {
+		sub.Close()
+	}
+	if _, err := sut.Subscribe(ctx, 0); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected err(%v) == %v", err, os.ErrClosed)
+	}
+}
+
+func TestLogBroadcasterCancelled(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "output.log")
+	if err := os.WriteFile(path, []byte("Hello"), 0o600); err != nil {
+		t.Fatalf("unexpected log file: %v", err)
+	}
+	sut, err := tjob.NewLogBroadcaster(path, &JobMock{})
+	if err != nil {
+		t.Fatalf("unexpected broadcaster: %v", err)
+	}
+	defer sut.Close()
+
+	// user cancels logs of job that never finishes
+	ctx, cancel := context.WithCancel(context.TODO())
+	logs, err := sut.Subscribe(ctx, 0)
+	if err != nil {
+		t.Fatalf("unexpected subscribe: %v", err)
+	}
+	defer logs.Close()
+	go func() {
+		<-time.After(100 * time.Millisecond)
+		cancel()
+	}()
+
+	out, err := io.ReadAll(logs)
+	if err != nil {
+		t.Fatalf("unexpected read: %v", err)
+	}
+	if string(out) != "Hello" {
+		t.Errorf("expected out(%s) == Hello", out)
+	}
+}
+
+// BenchmarkFollowers follows the logs of a busy job by many followers each
+// with its own JobReader or all subscribed to the same LogBroadcaster
+func BenchmarkFollowers(b *testing.B) {
+	for _, followers := range []int{10, 100, 500} {
+		// each JobReader takes one of the inotify instances of the user, at
+		// most 128 by default
+		if followers <= 100 {
+			b.Run(fmt.Sprintf("JobReader/%d", followers), func(b *testing.B) {
+				benchmarkFollowers(b, followers, false)
+			})
+		}
+		b.Run(fmt.Sprintf("LogBroadcaster/%d", followers), func(b *testing.B) {
+			benchmarkFollowers(b, followers, true)
+		})
+	}
+}
+
+func benchmarkFollowers(b *testing.B, followers int, shared bool) {
+	b.Helper()
+	b.ReportAllocs()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Minute)
+	defer cancel()
+
+	line := append(bytes.Repeat([]byte("x"), 99), '\n')
+	fds := 0
+	for range b.N {
+		path := filepath.Join(b.TempDir(), "output.log")
+		tmp, err := os.Create(path)
+		if err != nil {
+			b.Fatalf("unexpected log file: %v", err)
+		}
+		job := &JobMock{}
+		var hub *tjob.LogBroadcaster
+		if shared {
+			if hub, err = tjob.NewLogBroadcaster(path, job); err != nil {
+				b.Fatalf("unexpected broadcaster: %v", err)
+			}
+		}
+
+		before := openFiles()
+		wg := sync.WaitGroup{}
+		for range followers {
+			var logs io.ReadCloser
+			if shared {
+				logs, err = hub.Subscribe(ctx, 0)
+			} else {
+				logs, err = tjob.NewJobReader(ctx, path, job)
+			}
+			if err != nil {
+				b.Fatalf("unexpected logs: %v", err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { logs.Close() }()
+				_, _ = io.Copy(io.Discard, logs)
+			}()
+		}
+		fds += openFiles() - before
+
+		// job writes lines and stops
+		for range 1000 {
+			_, _ = tmp.Write(line)
+		}
+		_ = job.SetDone()
+		tmp.Close()
+		wg.Wait()
+	}
+	b.ReportMetric(float64(fds)/float64(b.N), "fds/op")
+}
+
+// openFiles returns the number of files open by the process
+func openFiles() int {
+	entries, _ := os.ReadDir("/proc/self/fd")
+	return len(entries)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/neildo/tjob"
+)
+
+// tjob-init runs the command of a job inside its jail for programs that set
+// Job.InitPath instead of calling tjob.Init() first in main.
+func main() {
+	if err := tjob.Init(); err != nil {
+		log.Fatalln(err.Error())
+	}
+	// Init only returns without error outside of a jail
+	fmt.Fprintf(os.Stderr, "Usage: %s is started by tjob as Job.InitPath\n", os.Args[0])
+	os.Exit(2) //nolint:mnd
+}
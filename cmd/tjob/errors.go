@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// exit codes by class of error
+const (
+	exitError = iota + 1
+	exitUsage
+	exitInvalid
+	exitNotFound
+	exitDenied
+	exitUnauthenticated
+	exitPrecondition
+	exitExhausted
+	exitUnavailable
+	exitTimedOut
+)
+
+// failures by gRPC code with the exit code and the message shown
+var failures = map[codes.Code]struct { //nolint:gochecknoglobals
+	exit int
+	msg  string
+}{
+	codes.InvalidArgument:    {exitInvalid, "invalid request"},
+	codes.NotFound:           {exitNotFound, "no such job"},
+	codes.PermissionDenied:   {exitDenied, "permission denied"},
+	codes.Unauthenticated:    {exitUnauthenticated, "unauthenticated, check -cert, -key and -ca"},
+	codes.FailedPrecondition: {exitPrecondition, "not possible in the state of the job"},
+	codes.ResourceExhausted:  {exitExhausted, "out of resources on server"},
+	codes.Unavailable:        {exitUnavailable, "server unavailable, check -host"},
+	codes.DeadlineExceeded:   {exitTimedOut, "timed out"},
+}
+
+// fatal prints the error with a message by its class and exits with its exit code
+func fatal(err error) {
+	msg, exit := explain(err)
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(exit)
+}
+
+// explain returns the error with a message by its class and its exit code
+func explain(err error) (string, int) {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) {
+		return fmt.Sprintf("error: %v", err), exitError
+	}
+	st := grpcErr.GRPCStatus()
+	f, ok := failures[st.Code()]
+	if !ok {
+		return fmt.Sprintf("error: %s", st.Message()), exitError
+	}
+	return fmt.Sprintf("%s: %s", f.msg, st.Message()), f.exit
+}
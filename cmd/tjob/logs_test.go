@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/neildo/tjob/internal/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	// logsCall of the fake client: the logs sent once opened unless failed
+	// before, and then the error ending them unless EOF
+	logsCall struct {
+		open error
+		outs []*proto.LogsResponse
+		err  error
+	}
+
+	// logsClient fakes the logs of a job over the calls in order
+	logsClient struct {
+		proto.JobClient
+		calls []logsCall
+		reqs  []*proto.LogsRequest
+	}
+
+	// logsStream fakes the logs of a call
+	logsStream struct {
+		grpc.ClientStream
+		call logsCall
+	}
+)
+
+func (c *logsClient) Logs(_ context.Context, req *proto.LogsRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[proto.LogsResponse], error) {
+	c.reqs = append(c.reqs, req)
+	call := c.calls[0]
+	c.calls = c.calls[1:]
+	return &logsStream{call: call}, nil
+}
+
+func (s *logsStream) Header() (metadata.MD, error) {
+	if s.call.open != nil {
+		return nil, s.call.open
+	}
+	return metadata.MD{}, nil
+}
+
+func (s *logsStream) Recv() (*proto.LogsResponse, error) {
+	if len(s.call.outs) > 0 {
+		out := s.call.outs[0]
+		s.call.outs = s.call.outs[1:]
+		return out, nil
+	}
+	if s.call.err != nil {
+		return nil, s.call.err
+	}
+	return nil, io.EOF
+}
+
+func TestPrintLogs(t *testing.T) {
+	t.Parallel()
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	out := func(s string, offset int64) *proto.LogsResponse {
+		return &proto.LogsResponse{Out: []byte(s), Offset: offset, NextOffset: offset + int64(len(s))}
+	}
+	tests := []struct {
+		name    string
+		req     *proto.LogsRequest
+		calls   []logsCall
+		code    codes.Code
+		stdout  string
+		stderr  string
+		offsets []int64 // requested by each call
+	}{
+		{
+			name:    "resumes after logs printed",
+			req:     &proto.LogsRequest{JobId: "abc"},
+			calls:   []logsCall{{outs: []*proto.LogsResponse{out("a\n", 0)}, err: unavailable}, {outs: []*proto.LogsResponse{out("b\n", 2)}}},
+			stdout:  "a\nb\n",
+			offsets: []int64{0, 2},
+		},
+		{
+			name:    "warns of logs dropped meanwhile",
+			req:     &proto.LogsRequest{JobId: "abc"},
+			calls:   []logsCall{{outs: []*proto.LogsResponse{out("a\n", 0)}, err: unavailable}, {outs: []*proto.LogsResponse{out("c\n", 6)}}},
+			stdout:  "a\nc\n",
+			stderr:  "4 bytes of logs dropped before offset 6\n",
+			offsets: []int64{0, 2},
+		},
+		{
+			name:    "warns of logs dropped before the first",
+			req:     &proto.LogsRequest{JobId: "abc"},
+			calls:   []logsCall{{outs: []*proto.LogsResponse{out("c\n", 6)}}},
+			stdout:  "c\n",
+			stderr:  "6 bytes of logs dropped before offset 6\n",
+			offsets: []int64{0},
+		},
+		{
+			name:    "tails from any offset",
+			req:     &proto.LogsRequest{JobId: "abc", TailLines: 1},
+			calls:   []logsCall{{outs: []*proto.LogsResponse{out("c\n", 6)}, err: unavailable}, {outs: []*proto.LogsResponse{out("d\n", 8)}}},
+			stdout:  "c\nd\n",
+			offsets: []int64{0, 8},
+		},
+		{
+			name:    "retries until opened again",
+			req:     &proto.LogsRequest{JobId: "abc"},
+			calls:   []logsCall{{err: unavailable}, {open: unavailable}, {outs: []*proto.LogsResponse{out("a\n", 0)}}},
+			stdout:  "a\n",
+			offsets: []int64{0, 0, 0},
+		},
+		{
+			name:    "fails unless ever opened",
+			req:     &proto.LogsRequest{JobId: "abc"},
+			calls:   []logsCall{{open: unavailable}},
+			code:    codes.Unavailable,
+			offsets: []int64{0},
+		},
+		{
+			name:    "fails unless unavailable",
+			req:     &proto.LogsRequest{JobId: "abc"},
+			calls:   []logsCall{{outs: []*proto.LogsResponse{out("a\n", 0)}, err: status.Error(codes.NotFound, "not found")}},
+			code:    codes.NotFound,
+			stdout:  "a\n",
+			offsets: []int64{0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout, stderr bytes.Buffer
+			client := &logsClient{calls: test.calls}
+			sut := &logPrinter{stdout: &stdout, stderr: &stderr}
+			err := sut.printLogs(context.Background(), client, test.req)
+			if code := status.Code(err); code != test.code {
+				t.Errorf("expected code(%v) == %v: %v", code, test.code, err)
+			}
+			if stdout.String() != test.stdout {
+				t.Errorf("expected stdout(%q) == %q", stdout.String(), test.stdout)
+			}
+			if stderr.String() != test.stderr {
+				t.Errorf("expected stderr(%q) == %q", stderr.String(), test.stderr)
+			}
+			if len(client.reqs) != len(test.offsets) {
+				t.Fatalf("expected calls(%d) == %d", len(client.reqs), len(test.offsets))
+			}
+			for i, req := range client.reqs {
+				if req.GetOffsetBytes() != test.offsets[i] {
+					t.Errorf("call %d: expected offset(%d) == %d", i, req.GetOffsetBytes(), test.offsets[i])
+				}
+				if i > 0 && (req.GetTailLines() != 0 || req.GetSince() != nil) {
+					t.Errorf("call %d: expected neither tail nor since once resuming: %v", i, req)
+				}
+			}
+		})
+	}
+}
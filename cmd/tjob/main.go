@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
@@ -8,18 +10,36 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/neildo/tjob/internal/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const (
-	subcommands = "run stop ps logs"
+	subcommands = "run stop ps logs wait rm"
 	cmdSize     = 20
+	pageSize    = 100
+	clearScreen = "\033[H\033[2J"
+
+	// backoff reconnecting to the logs once the server is unavailable, giving
+	// up after failing for reconnectTimeout
+	reconnectMin     = 100 * time.Millisecond
+	reconnectMax     = 5 * time.Second
+	reconnectTimeout = time.Minute
 )
 
 const (
@@ -27,8 +47,24 @@ const (
 Commands:
   run	[OPTIONS] COMMAND [ARG...]
   stop	[OPTIONS] JOB
-  ps	[OPTIONS] JOB
-  logs	[OPTIONS] JOB
+  ps	[OPTIONS] [JOB]
+  ps	-w [OPTIONS] [JOB...]
+  logs	[-f] [-t] [-tail N] [-since DURATION] [OPTIONS] JOB
+  wait	[OPTIONS] JOB
+  rm	[-f] [OPTIONS] JOB [JOB...]
+
+Exit codes:
+  1	error
+  2	usage
+  3	invalid request
+  4	no such job
+  5	permission denied
+  6	unauthenticated
+  7	not possible in the state of the job
+  8	out of resources on server
+  9	server unavailable
+  10	timed out
+  N	exit code of job with -wait, -f or wait
 
 Options:`
 )
@@ -45,23 +81,90 @@ func main() {
 		ca   = flag.String("ca", ".tjob/ca.crt", "CA cert file") //nolint:varnamelen
 		cert = flag.String("cert", ".tjob/cli.crt", "cli cert file")
 		key  = flag.String("key", ".tjob/cli.key", "cli key file")
+		tout = flag.Duration("timeout", 0, "max run time of job capped by server")
+		idle = flag.Duration("idle-timeout", 0, "max time without output of job capped by server")
+		rest = flag.String("restart", "", "restart policy of job: never, on-failure[:max-retries] or always")
+
+		healthCmd      = flag.String("health-cmd", "", "command inside job healthy on exit 0")
+		healthPort     = flag.Int("health-port", 0, "TCP port on job loopback healthy once accepting")
+		healthPath     = flag.String("health-path", "", "HTTP path on health port healthy on 2xx or 3xx")
+		healthInterval = flag.Duration("health-interval", 0, "time between health probes of at least 1s")
+		healthTimeout  = flag.Duration("health-timeout", 0, "time for each health probe of at least 1s")
+		healthRetries  = flag.Int("health-retries", 0, "consecutive failures until unhealthy")
+		onUnhealthy    = flag.String("on-unhealthy", "", "once unhealthy: none, restart or stop")
+
+		watch  = flag.Bool("w", false, "watch status of jobs or all jobs until Ctrl+C")
+		wait   = flag.Bool("wait", false, "wait for job to stop and exit with its exit code")
+		until  = flag.Duration("wait-timeout", 0, "max time to wait for job unless zero")
+		follow = flag.Bool("f", false, "follow logs of job until stopped, with run also exit with its exit code, or with rm stop a running job first")
+		rm     = flag.Bool("rm", false, "remove job and its logs once stopped")
+
+		all      = flag.Bool("a", false, "list stopped jobs too")
+		since    = flag.Duration("since", 0, "list jobs started, or show logs written, within duration")
+		stamps   = flag.Bool("t", false, "show the time of each line of logs")
+		tail     = flag.Int("tail", 0, "show the last lines of logs unless zero")
+		compress = flag.Bool("compress", false, "compress logs streamed from server with gzip")
+		filter   = flag.String("cmd", "", "list jobs with substring in command")
+		labels   = make(map[string]string)
+
+		policy = flag.String("log-policy", "", "at log limit of job: truncate the oldest, stop writing or kill")
+		limit  int64
+
+		cpu    = flag.Int("cpu", 0, "cpu percentage of job within server max")
+		mem    = flag.Int("mem", 0, "memory in MB of job within server max")
+		limits = &proto.Limits{}
+
+		// flags of rm where -f forces instead of following
+		rmFlags = flag.NewFlagSet("rm", flag.ExitOnError)
+		force   = rmFlags.Bool("f", false, "stop a running job first")
 	)
+	flag.Func("rbps", "reads in bytes/sec of job like 10M within server max", func(s string) error {
+		var err error
+		limits.ReadBps, err = parseBytes(s)
+		return err
+	})
+	flag.Func("wbps", "writes in bytes/sec of job like 10M within server max", func(s string) error {
+		var err error
+		limits.WriteBps, err = parseBytes(s)
+		return err
+	})
+	flag.Func("log-limit", "max bytes of logs of job like 10M within server max", func(s string) error {
+		var err error
+		limit, err = parseBytes(s)
+		return err
+	})
+	flag.Func("label", "label key=value of job to run or list, repeatable", func(s string) error {
+		k, v, _ := strings.Cut(s, "=")
+		labels[k] = v
+		return nil
+	})
+	// all other flags are shared with rm
+	flag.VisitAll(func(f *flag.Flag) {
+		if rmFlags.Lookup(f.Name) == nil {
+			rmFlags.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	rmFlags.Usage = usage
+
 	args := os.Args
 	cmd := ""
 	if len(args) > 1 && strings.Contains(subcommands, os.Args[1]) {
 		cmd = args[1]
 		args = args[2:]
-		if strings.HasPrefix(args[0], "-") {
-			_ = flag.CommandLine.Parse(args)
+		flags := flag.CommandLine
+		if cmd == "rm" {
+			flags = rmFlags
 		}
 		// skip over any flags
-		for len(args) > 0 && strings.HasPrefix(args[0], "-") {
-			args = args[2:]
+		if len(args) > 0 && strings.HasPrefix(args[0], "-") {
+			_ = flags.Parse(args)
+			args = flags.Args()
 		}
 	}
-	if len(args) == 0 || cmd == "" {
+	// watch all jobs unless given
+	if cmd == "" || len(args) == 0 && cmd != "ps" {
 		usage()
-		return
+		os.Exit(exitUsage)
 	}
 
 	certs, pool, err := proto.NewCertificates(*cert, *key, *ca)
@@ -84,55 +187,401 @@ func main() {
 
 	switch cmd {
 	case "run":
-		r, err := client.Run(ctx, &proto.RunRequest{Path: args[0], Args: args[1:]})
+		limits.CpuPercent, limits.MemoryMb = int32(*cpu), int32(*mem)
+		req := &proto.RunRequest{Path: args[0], Args: args[1:], Restart: *rest, Labels: labels, Limits: limits}
+		req.LogLimit, req.LogPolicy = limit, *policy
+		// removed by the server once stopped even if the client detaches or dies
+		req.AutoRemove = *rm
+		if *tout > 0 {
+			req.Timeout = durationpb.New(*tout)
+		}
+		if *idle > 0 {
+			req.IdleTimeout = durationpb.New(*idle)
+		}
+		if *healthCmd != "" || *healthPort > 0 {
+			req.HealthCheck = &proto.HealthCheck{
+				Cmd:         strings.Fields(*healthCmd),
+				Port:        int32(*healthPort),
+				HttpPath:    *healthPath,
+				Interval:    durationpb.New(*healthInterval),
+				Timeout:     durationpb.New(*healthTimeout),
+				Retries:     int32(*healthRetries),
+				OnUnhealthy: *onUnhealthy,
+			}
+		}
+		r, err := client.Run(ctx, req)
 		if err != nil {
-			log.Fatalln(err.Error()) //nolint:gocritic
+			fatal(err)
 		}
 		fmt.Println(r.GetJobId())
+		if *follow {
+			followJob(ctx, client, &logPrinter{timestamps: *stamps, compress: *compress, stdout: os.Stdout, stderr: os.Stderr}, r.GetJobId(), *rm)
+		} else if *wait {
+			exitJob(waitJob(ctx, client, r.GetJobId(), *until, *rm))
+		}
 	case "stop":
 		id := args[0]
 		_, err := client.Stop(ctx, &proto.StopRequest{JobId: id})
 		if err != nil {
-			log.Fatalln(err.Error())
+			fatal(err)
 		}
 		fmt.Println(id)
 	case "ps":
+		if *watch {
+			if err := watchJobs(ctx, client, args, os.Stdout); err != nil {
+				fatal(err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			req := &proto.ListRequest{Labels: labels, Cmd: *filter, Order: proto.ListRequest_NEWEST_FIRST}
+			if !*all {
+				req.State = "running"
+			}
+			if *since > 0 {
+				req.StartedAfter = timestamppb.New(time.Now().Add(-*since))
+			}
+			listJobs(ctx, client, req)
+			return
+		}
 		id := args[0]
 		resp, err := client.Status(ctx, &proto.StatusRequest{JobId: id})
 		if err != nil {
-			log.Fatalln(err.Error())
+			fatal(err)
 		} else if resp.GetJob() == nil {
 			log.Fatalln("no status")
 		}
-		job := resp.GetJob()
+		printJobs(os.Stdout, resp.GetJob())
+	case "logs":
+		req := &proto.LogsRequest{JobId: args[0], NoFollow: !*follow, TailLines: int32(*tail)}
+		if *since > 0 {
+			req.Since = timestamppb.New(time.Now().Add(-*since))
+		}
+		printer := &logPrinter{timestamps: *stamps, compress: *compress, stdout: os.Stdout, stderr: os.Stderr}
+		if err := printer.printLogs(ctx, client, req); err != nil {
+			fatal(err)
+		}
+	case "wait":
+		exitJob(waitJob(ctx, client, args[0], *until, false))
+	case "rm":
+		// exit code of the last failure
+		exit := 0
+		for _, id := range args {
+			if _, err := client.Remove(ctx, &proto.RemoveRequest{JobId: id, Force: *force}); err != nil {
+				var msg string
+				msg, exit = explain(err)
+				fmt.Fprintln(os.Stderr, msg)
+				continue
+			}
+			fmt.Println(id)
+		}
+		if exit != 0 {
+			os.Exit(exit)
+		}
+
+	default:
+		usage()
+	}
+}
+
+// logPrinter prints the logs of jobs with the time of each line if framed by
+// the server
+type logPrinter struct {
+	timestamps bool
+
+	// compress the logs streamed with gzip
+	compress bool
+
+	// true for each stream in the middle of a line
+	partial map[string]bool
+
+	// output of the logs by stream and of warnings to stderr
+	stdout, stderr io.Writer
+
+	// offset to resume at once any logs printed
+	next    int64
+	printed bool
+}
+
+// printLogs prints the logs of the job as written, until it stops if followed.
+// Once the server is unavailable after connecting, it reconnects with backoff
+// to resume right after the logs printed so far.
+func (p *logPrinter) printLogs(ctx context.Context, client proto.JobClient, req *proto.LogsRequest) error {
+	var (
+		backoff = reconnectMin
+		// since disconnected if ever connected
+		failed time.Time
+	)
+	for {
+		connected, err := p.printStream(ctx, client, req)
+		if err == nil || status.Code(err) != codes.Unavailable {
+			return err
+		}
+		if connected {
+			backoff, failed = reconnectMin, time.Now()
+		}
+		if failed.IsZero() || time.Since(failed) > reconnectTimeout {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, reconnectMax)
+
+		// neither tail nor since again once resuming
+		if p.printed {
+			req = &proto.LogsRequest{JobId: req.GetJobId(), NoFollow: req.GetNoFollow(), OffsetBytes: p.next}
+		}
+	}
+}
+
+// printStream prints the logs of one call and returns whether connected once
+// the server opened them
+func (p *logPrinter) printStream(ctx context.Context, client proto.JobClient, req *proto.LogsRequest) (bool, error) {
+	var opts []grpc.CallOption
+	if p.compress {
+		opts = append(opts, grpc.UseCompressor(gzip.Name))
+	}
+	logs, err := client.Logs(ctx, req, opts...)
+	if err != nil {
+		return false, fmt.Errorf("logs: %w", err)
+	}
+	// the server sends the header once it opened the logs
+	header, err := logs.Header()
+	if err != nil {
+		return false, fmt.Errorf("logs: %w", err)
+	}
+	connected := header != nil
+
+	// offset of the logs expected next to warn of those dropped meanwhile,
+	// unknown before the first logs of tail or since
+	want, known := req.GetOffsetBytes(), req.GetTailLines() == 0 && req.GetSince() == nil
+	for {
+		out, err := logs.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return connected, nil
+			}
+			return connected, fmt.Errorf("logs: %w", err)
+		}
+		if known && out.GetOffset() > want {
+			fmt.Fprintf(p.stderr, "%d bytes of logs dropped before offset %d\n", out.GetOffset()-want, out.GetOffset())
+		}
+		want, known = out.GetNextOffset(), true
+		p.print(out)
+		p.next, p.printed = out.GetNextOffset(), true
+	}
+}
 
-		fmt.Printf("%-10s%-20s   %-12s%-10s\n", "JOB ID", "COMMAND", "CREATED", "STATUS")
+// print prints the output to stderr if written there or else stdout
+func (p *logPrinter) print(out *proto.LogsResponse) {
+	w := p.stdout
+	if out.GetStream() == "stderr" {
+		w = p.stderr
+	}
+	if !p.timestamps || out.GetTime() == nil {
+		_, _ = w.Write(out.GetOut())
+		return
+	}
+
+	// prefix the time at the start of each line
+	if p.partial == nil {
+		p.partial = make(map[string]bool)
+	}
+	stamp := out.GetTime().AsTime().Local().Format(time.RFC3339Nano) + " "
+	for _, line := range bytes.SplitAfter(out.GetOut(), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !p.partial[out.GetStream()] {
+			_, _ = io.WriteString(w, stamp)
+		}
+		_, _ = w.Write(line)
+		p.partial[out.GetStream()] = line[len(line)-1] != '\n'
+	}
+}
+
+// followJob prints the logs of the job by the printer until it stops and exits
+// with its exit code, after removing it if rm. Ctrl+C asks to either detach from
+// the job or stop it.
+func followJob(ctx context.Context, client proto.JobClient, printer *logPrinter, id string, rm bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var detached atomic.Bool
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	defer signal.Stop(sigCh)
+	go func() {
+		input := bufio.NewReader(os.Stdin)
+		for range sigCh {
+			fmt.Fprintf(os.Stderr, "\ndetach from or stop job %s? [d/s] ", id)
+			answer, _ := input.ReadString('\n')
+			switch strings.TrimSpace(answer) {
+			case "d":
+				detached.Store(true)
+				cancel()
+				return
+			case "s":
+				if _, err := client.Stop(ctx, &proto.StopRequest{JobId: id}); err != nil {
+					fmt.Fprintln(os.Stderr, err.Error())
+				}
+			}
+		}
+	}()
+
+	// wait from the start for the final status of the job removed once stopped
+	type result struct {
+		exit int
+		err  error
+	}
+	waited := make(chan result, 1)
+	go func() {
+		exit, err := waitJob(ctx, client, id, 0, rm)
+		waited <- result{exit, err}
+	}()
+
+	err := printer.printLogs(ctx, client, &proto.LogsRequest{JobId: id})
+	if detached.Load() {
+		return
+	}
+	if err != nil {
+		fatal(err)
+	}
+	r := <-waited
+	exitJob(r.exit, r.err)
+}
+
+// waitJob waits for the job to stop within timeout unless zero and returns its
+// exit code, or 128 + signal if killed, after removing it if rm unless removed
+// already
+func waitJob(ctx context.Context, client proto.JobClient, id string, timeout time.Duration, rm bool) (int, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	resp, err := client.Wait(ctx, &proto.WaitRequest{JobId: id})
+	if err != nil {
+		return 0, fmt.Errorf("wait: %w", err)
+	}
+	if msg := resp.GetJob().GetError(); msg != "" {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+	if rm {
+		if _, err := client.Remove(ctx, &proto.RemoveRequest{JobId: id}); err != nil && status.Code(err) != codes.NotFound {
+			return 0, fmt.Errorf("remove: %w", err)
+		}
+	}
+	return int(resp.GetJob().GetExit()), nil
+}
+
+// exitJob exits with the exit code of the job unless err
+func exitJob(exit int, err error) {
+	if err != nil {
+		fatal(err)
+	}
+	os.Exit(exit)
+}
+
+// parseBytes parses the non-negative number of bytes with an optional K, M or G suffix
+func parseBytes(s string) (int64, error) {
+	shift := 0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bytes: %w", err)
+	}
+	if n < 0 || n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("bytes %s: %w", s, strconv.ErrRange)
+	}
+	return n << shift, nil
+}
+
+// printJobs prints the table of the status of jobs to w
+func printJobs(w io.Writer, jobs ...*proto.Status) {
+	fmt.Fprintf(w, "%-10s%-20s   %-12s%-10s\n", "JOB ID", "COMMAND", "CREATED", "STATUS")
+	for _, job := range jobs {
 		created := time.Since(job.GetStartedAt().AsTime()).Truncate(time.Second)
 		status := job.GetRan().AsDuration().Truncate(time.Second).String()
 		if job.Exit != nil {
 			status = fmt.Sprintf("Exit (%d) %s", job.GetExit(), strings.ReplaceAll(job.GetError(), "\n", ";"))
 		}
+		if job.Exit == nil && job.GetHealth() != "" {
+			status = fmt.Sprintf("%s (%s)", status, job.GetHealth())
+		}
+		if job.GetRestarts() > 0 {
+			status = fmt.Sprintf("%s Restarts (%d)", status, job.GetRestarts())
+		}
+		if job.GetTruncated() {
+			status += " (truncated)"
+		}
 		n := min(len(job.GetCmd()), cmdSize)
-		fmt.Printf("%-10s\"%-20s\" %-12s%-10s\n", job.GetJobId(), job.GetCmd()[:n], created, status)
-	case "logs":
-		id := args[0]
+		fmt.Fprintf(w, "%-10s\"%-20s\" %-12s%-10s\n", job.GetJobId(), job.GetCmd()[:n], created, status)
+	}
+}
 
-		logs, err := client.Logs(ctx, &proto.LogsRequest{JobId: id})
+// listJobs prints the table of all pages of jobs matching the request
+func listJobs(ctx context.Context, client proto.JobClient, req *proto.ListRequest) {
+	var jobs []*proto.Status
+	req.PageSize = pageSize
+	for {
+		resp, err := client.List(ctx, req)
 		if err != nil {
-			log.Fatalln(err.Error())
+			fatal(err)
 		}
-		for {
-			out, err := logs.Recv()
-			if err != nil {
-				if errors.Is(err, io.EOF) {
-					break
-				}
-				log.Fatalln(err.Error())
+		jobs = append(jobs, resp.GetJobs()...)
+		if req.PageToken = resp.GetNextPageToken(); req.PageToken == "" {
+			break
+		}
+	}
+	printJobs(os.Stdout, jobs...)
+}
+
+// watchJobs redraws the table of jobs to w as their status changes, dropping
+// those removed, until Ctrl+C
+func watchJobs(ctx context.Context, client proto.JobClient, ids []string, w io.Writer) error {
+	stream, err := client.Watch(ctx, &proto.WatchRequest{JobIds: ids})
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	jobs := make(map[string]*proto.Status)
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
 			}
-			fmt.Print(string(out.GetOut()))
+			return fmt.Errorf("watch: %w", err)
+		}
+		job := resp.GetJob()
+		if resp.GetEvent() == "removed" {
+			delete(jobs, job.GetJobId())
+		} else {
+			jobs[job.GetJobId()] = job
 		}
 
-	default:
-		usage()
+		// oldest jobs first
+		sorted := make([]*proto.Status, 0, len(jobs))
+		for _, job := range jobs {
+			sorted = append(sorted, job)
+		}
+		slices.SortFunc(sorted, func(a, b *proto.Status) int {
+			return a.GetStartedAt().AsTime().Compare(b.GetStartedAt().AsTime())
+		})
+		fmt.Fprint(w, clearScreen)
+		printJobs(w, sorted...)
 	}
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in  string
+		out int64
+		err error
+	}{
+		{"0", 0, nil},
+		{"512", 512, nil},
+		{"10K", 10 << 10, nil},
+		{"10M", 10 << 20, nil},
+		{"2G", 2 << 30, nil},
+		{"8589934591G", 8589934591 << 30, nil},
+		{"", 0, strconv.ErrSyntax},
+		{"M", 0, strconv.ErrSyntax},
+		{"1.5M", 0, strconv.ErrSyntax},
+		{"10X", 0, strconv.ErrSyntax},
+		{"10k", 0, strconv.ErrSyntax},
+		{"10MB", 0, strconv.ErrSyntax},
+		{"-1", 0, strconv.ErrRange},
+		{"-1K", 0, strconv.ErrRange},
+		{"8589934592G", 0, strconv.ErrRange},
+		{"99999999999999999999", 0, strconv.ErrRange},
+	}
+	for _, test := range tests {
+		out, err := parseBytes(test.in)
+		if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+			t.Errorf("%q: expected err(%v) == %v", test.in, err, test.err)
+			continue
+		}
+		if out != test.out {
+			t.Errorf("%q: expected out(%d) == %d", test.in, out, test.out)
+		}
+	}
+}
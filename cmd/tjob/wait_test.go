@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/neildo/tjob/internal/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// waitClient fakes the wait for a job stopped with exit and its removal failing with err
+type waitClient struct {
+	proto.JobClient
+	exit    int32
+	err     error
+	removed bool
+}
+
+func (c *waitClient) Wait(_ context.Context, req *proto.WaitRequest, _ ...grpc.CallOption) (*proto.WaitResponse, error) {
+	return &proto.WaitResponse{Job: &proto.Status{JobId: req.GetJobId(), Exit: &c.exit}}, nil
+}
+
+func (c *waitClient) Remove(_ context.Context, _ *proto.RemoveRequest, _ ...grpc.CallOption) (*proto.RemoveResponse, error) {
+	c.removed = true
+	return &proto.RemoveResponse{}, c.err
+}
+
+func TestWaitJob(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		rm      bool
+		err     error
+		removed bool
+		code    codes.Code
+	}{
+		{name: "kept", rm: false},
+		{name: "removed", rm: true, removed: true},
+		{name: "removed by server", rm: true, err: status.Error(codes.NotFound, "not found"), removed: true},
+		{name: "not removed", rm: true, err: status.Error(codes.PermissionDenied, "denied"), removed: true, code: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &waitClient{exit: 3, err: tt.err}
+			exit, err := waitJob(context.TODO(), client, "a", 0, tt.rm)
+			if tt.code != codes.OK {
+				if status.Code(err) != tt.code {
+					t.Errorf("expected code(%v) == %v", status.Code(err), tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected wait: %v", err)
+			}
+			if exit != 3 {
+				t.Errorf("expected exit(%d) == 3", exit)
+			}
+			if client.removed != tt.removed {
+				t.Errorf("expected removed(%v) == %v", client.removed, tt.removed)
+			}
+		})
+	}
+}
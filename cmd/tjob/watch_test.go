@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob/internal/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type (
+	// watchClient fakes the watch of jobs with the responses and then the
+	// error ending them unless EOF
+	watchClient struct {
+		proto.JobClient
+		outs []*proto.WatchResponse
+		err  error
+		req  *proto.WatchRequest
+	}
+
+	// watchStream fakes the responses of a watch
+	watchStream struct {
+		grpc.ClientStream
+		client *watchClient
+	}
+)
+
+func (c *watchClient) Watch(_ context.Context, req *proto.WatchRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[proto.WatchResponse], error) {
+	c.req = req
+	return &watchStream{client: c}, nil
+}
+
+func (s *watchStream) Recv() (*proto.WatchResponse, error) {
+	if len(s.client.outs) > 0 {
+		out := s.client.outs[0]
+		s.client.outs = s.client.outs[1:]
+		return out, nil
+	}
+	if s.client.err != nil {
+		return nil, s.client.err
+	}
+	return nil, io.EOF
+}
+
+func TestWatchJobs(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	job := func(id string, after time.Duration, exit *int32) *proto.Status {
+		return &proto.Status{JobId: id, Cmd: "sleep " + id, StartedAt: timestamppb.New(now.Add(after)), Exit: exit}
+	}
+	exit := int32(0)
+	tests := []struct {
+		name string
+		outs []*proto.WatchResponse
+		err  error
+		code codes.Code
+		// rows of the last table redrawn
+		rows []string
+	}{
+		{
+			name: "oldest first",
+			outs: []*proto.WatchResponse{
+				{Job: job("def", time.Second, nil), Event: "started"},
+				{Job: job("abc", 0, nil), Event: "started"},
+			},
+			rows: []string{"abc", "def"},
+		},
+		{
+			name: "changed in place",
+			outs: []*proto.WatchResponse{
+				{Job: job("abc", 0, nil), Event: "started"},
+				{Job: job("def", time.Second, nil), Event: "started"},
+				{Job: job("abc", 0, &exit), Event: "exited"},
+			},
+			rows: []string{"abc Exit (0)", "def"},
+		},
+		{
+			name: "removed dropped",
+			outs: []*proto.WatchResponse{
+				{Job: job("abc", 0, nil), Event: "started"},
+				{Job: job("def", time.Second, nil), Event: "started"},
+				{Job: job("abc", 0, &exit), Event: "removed"},
+			},
+			rows: []string{"def"},
+		},
+		{
+			name: "fails once cut off",
+			outs: []*proto.WatchResponse{{Job: job("abc", 0, nil), Event: "started"}},
+			err:  status.Error(codes.Unavailable, "unavailable"),
+			code: codes.Unavailable,
+			rows: []string{"abc"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			client := &watchClient{outs: test.outs, err: test.err}
+			err := watchJobs(context.Background(), client, []string{"abc", "def"}, &out)
+			if code := status.Code(err); code != test.code {
+				t.Errorf("expected code(%v) == %v: %v", code, test.code, err)
+			}
+			if ids := client.req.GetJobIds(); len(ids) != 2 {
+				t.Errorf("expected ids(%v) == [abc def]", ids)
+			}
+			// the table redrawn once per response
+			tables := strings.Split(out.String(), clearScreen)
+			if len(tables) != len(test.outs)+1 {
+				t.Fatalf("expected tables(%d) == %d", len(tables)-1, len(test.outs))
+			}
+			rows := strings.Split(strings.TrimSpace(tables[len(tables)-1]), "\n")[1:]
+			if len(rows) != len(test.rows) {
+				t.Fatalf("expected rows(%q) == %q", rows, test.rows)
+			}
+			for i, row := range rows {
+				id, status, _ := strings.Cut(test.rows[i], " ")
+				if !strings.HasPrefix(row, id) || !strings.Contains(row, status) {
+					t.Errorf("expected row(%q) of %q", row, test.rows[i])
+				}
+			}
+		})
+	}
+}
@@ -1,31 +1,58 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"log"
 	"net"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	// compressor of logs for clients asking for it
+	_ "google.golang.org/grpc/encoding/gzip"
 
 	"github.com/neildo/tjob"
 	"github.com/neildo/tjob/internal/proto"
 	"github.com/neildo/tjob/internal/service"
 )
 
+// most bytes of logs per message well within the 4 MiB clients receive
+const maxLogChunk = 1 << 20
+
 func main() {
 	var (
 		mnt  = flag.String("mnt", "", "MAJ:MIN device number for mnt namespace")
-		cpu  = flag.Int("cpu", 20, "max cpu percentage")
-		mem  = flag.Int("mem", 20, "max memory in MB")
-		rbps = flag.Int("rbps", 20*1024*1024, "max reads in bytes/sec")
-		wbps = flag.Int("wbps", 20*1024*1024, "max writes in bytes/sec")
+		shim = flag.String("init", "", "tjob-init helper path instead of re-executing tjobs")
+		cpu  = flag.Int("cpu", 20, "default cpu percentage of jobs")
+		mem  = flag.Int("mem", 20, "default memory in MB of jobs")
+		rbps = flag.Int("rbps", 20*1024*1024, "default reads in bytes/sec of jobs")
+		wbps = flag.Int("wbps", 20*1024*1024, "default writes in bytes/sec of jobs")
+		lims = flag.String("user-limits", "", "JSON file of max limits by user instead of -max-*")
+		age  = flag.Duration("max-age", 24*time.Hour, "remove stopped jobs after duration or 0 for never")
+		jobs = flag.Int("max-jobs", 100, "max stopped jobs kept per user or 0 for all")
+		logs = flag.Int64("max-log-bytes", 1<<30, "max log bytes of all jobs kept by removing stopped jobs or 0 for all")
+		dir  = flag.String("state-dir", "/var/lib/tjob", "directory of the journal of jobs or empty for none")
+		llim = flag.Int64("log-limit", 0, "default and max bytes of logs kept per job or 0 for none")
+		lpol = flag.String("log-policy", tjob.LogTruncate, "default at log limit: truncate the oldest, stop writing or kill")
+		lfmt = flag.String("log-format", tjob.LogRaw, "format of logs: raw output or framed with the time of each output")
+		ldir = flag.String("log-dir", "/var/log/tjob", "directory of the logs of jobs by user or empty for temporary files")
+		lchk = flag.Int("log-chunk", 64*1024, "max bytes of logs per message streamed")
+		llat = flag.Duration("log-latency", 10*time.Millisecond, "time to coalesce logs into one message streamed or 0 for none")
+		tout = flag.Duration("timeout", 0, "max run time of jobs without restart backoffs or 0 for none")
+		idle = flag.Duration("idle-timeout", 0, "max time without output of jobs or 0 for none")
 		host = flag.String("host", "localhost:8080", "server url")
 		ca   = flag.String("ca", ".tjob/ca.crt", "CA cert file") //nolint:varnamelen
 		cert = flag.String("cert", ".tjob/svc.crt", "server cert file")
 		key  = flag.String("key", ".tjob/svc.key", "server key file")
+
+		maxima service.Limits
 	)
+	flag.IntVar(&maxima.CPUPercent, "max-cpu", 100, "max cpu percentage requested or 0 for none")
+	flag.IntVar(&maxima.MemoryMB, "max-mem", 1024, "max memory in MB requested or 0 for none")
+	flag.IntVar(&maxima.ReadBPS, "max-rbps", 100*1024*1024, "max reads in bytes/sec requested or 0 for none")
+	flag.IntVar(&maxima.WriteBPS, "max-wbps", 100*1024*1024, "max writes in bytes/sec requested or 0 for none")
 
 	// MUST init tjob before starting any job for isolation
 	if err := tjob.Init(); err != nil {
@@ -37,6 +64,22 @@ func main() {
 	if *mnt == "" {
 		log.Fatal("-mnt required")
 	}
+	if _, err := tjob.ParseLogPolicy(*lpol); err != nil {
+		log.Fatalln(err.Error())
+	}
+	if _, err := tjob.ParseLogFormat(*lfmt); err != nil {
+		log.Fatalln(err.Error())
+	}
+	if *lchk <= 0 || *lchk > maxLogChunk {
+		log.Fatalf("-log-chunk must be within 1 and %d", maxLogChunk)
+	}
+	var users map[string]service.Limits
+	if *lims != "" {
+		var err error
+		if users, err = service.ReadUserLimits(*lims); err != nil {
+			log.Fatalln(err.Error())
+		}
+	}
 	certs, pool, err := proto.NewCertificates(*cert, *key, *ca)
 	if err != nil {
 		log.Fatalf("certs: %v", err)
@@ -50,14 +93,43 @@ func main() {
 
 	server := grpc.NewServer(
 		grpc.Creds(creds),
+		grpc.ChainUnaryInterceptor(service.UnaryErrors),
+		grpc.ChainStreamInterceptor(service.StreamErrors),
 	)
-	proto.RegisterJobServer(server, &service.JobServer{
+	jobServer := &service.JobServer{
 		Mnt:        *mnt,
+		InitPath:   *shim,
 		CPUPercent: *cpu,
 		MemoryMB:   *mem,
 		ReadBPS:    *rbps,
 		WriteBPS:   *wbps,
-	})
+		MaxLimits:  maxima,
+		UserLimits: users,
+
+		MaxTimeout:     *tout,
+		MaxIdleTimeout: *idle,
+		Retention: service.Retention{
+			MaxAge:      *age,
+			MaxJobs:     *jobs,
+			MaxLogBytes: *logs,
+		},
+		LogLimit:  *llim,
+		LogPolicy: *lpol,
+		LogFormat: *lfmt,
+		LogDir:    *ldir,
+
+		LogChunk:   *lchk,
+		LogLatency: *llat,
+	}
+	// orphans are only told apart from other jobs by the journal
+	if *dir != "" {
+		if err := jobServer.Restore(*dir); err != nil {
+			log.Fatalln(err.Error())
+		}
+		clean(jobServer)
+	}
+	proto.RegisterJobServer(server, jobServer)
+	go jobServer.Collect(context.Background())
 	listener, err := net.Listen("tcp", *host)
 	if err != nil {
 		log.Fatalf("listen: %v", err)
@@ -68,3 +140,21 @@ func main() {
 		log.Fatalf("serve: %v", err)
 	}
 }
+
+// clean removes the cgroups and logs of orphans left by earlier runs
+func clean(jobServer *service.JobServer) {
+	orphans, err := jobServer.Clean()
+	for _, cgroup := range orphans.Cgroups {
+		log.Printf("cleaned cgroup %s", cgroup)
+	}
+	for _, logPath := range orphans.Logs {
+		log.Printf("cleaned log %s", logPath)
+	}
+	if len(orphans.Cgroups) > 0 || len(orphans.Logs) > 0 {
+		log.Printf("cleaned %d cgroups, %d processes and %d logs of orphans",
+			len(orphans.Cgroups), orphans.Killed, len(orphans.Logs))
+	}
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
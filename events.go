@@ -0,0 +1,139 @@
+package tjob
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// types of Event in the job lifecycle
+const (
+	EventCreated  = "created"
+	EventStarted  = "started"
+	EventPaused   = "paused"
+	EventResumed  = "resumed"
+	EventOOM      = "oom"
+	EventSignaled = "signaled"
+	EventExited   = "exited"
+	EventRemoved  = "removed"
+)
+
+type (
+	// Event of the job lifecycle
+	Event struct {
+		Type   string
+		Time   time.Time
+		Pid    int
+		Exit   int32          // exit code when exited
+		Signal syscall.Signal // signal when signaled
+	}
+
+	// events fans out each event to all subscribers starting with the last one
+	events struct {
+		mu   sync.Mutex
+		subs map[*subscriber]struct{}
+		last Event
+	}
+
+	// subscriber queues the events not yet received, without bound for slow
+	// subscribers to never miss any
+	subscriber struct {
+		queue []Event
+		// signaled once queued or closed
+		ready chan struct{}
+		// true once no more events after those queued
+		closed bool
+	}
+)
+
+// Events returns the last event of the job followed by every event until ctx is
+// done or the job is removed. Events wait for slow subscribers so cancel ctx
+// once no longer receiving them.
+func (j *Job) Events(ctx context.Context) <-chan Event {
+	return j.events.subscribe(ctx)
+}
+
+func (e *events) subscribe(ctx context.Context) <-chan Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sub := &subscriber{ready: make(chan struct{}, 1)}
+	if !e.last.Time.IsZero() {
+		sub.queue = append(sub.queue, e.last)
+	}
+	if e.last.Type == EventRemoved {
+		sub.closed = true
+	} else {
+		if e.subs == nil {
+			e.subs = make(map[*subscriber]struct{})
+		}
+		e.subs[sub] = struct{}{}
+	}
+	ch := make(chan Event)
+	go e.forward(ctx, sub, ch)
+	return ch
+}
+
+// forward sends the events queued for the subscriber to ch in order until ctx
+// is done or closed, and unsubscribes on return
+func (e *events) forward(ctx context.Context, sub *subscriber, ch chan<- Event) {
+	defer close(ch)
+	defer e.unsubscribe(sub)
+	for {
+		e.mu.Lock()
+		queue, closed := sub.queue, sub.closed
+		sub.queue = nil
+		e.mu.Unlock()
+
+		for _, ev := range queue {
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if closed {
+			return
+		}
+		select {
+		case <-sub.ready:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// unsubscribe stops queuing events for the subscriber
+func (e *events) unsubscribe(sub *subscriber) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.subs, sub)
+}
+
+// emit queues the event for all subscribers without blocking and closes them
+// once removed
+func (e *events) emit(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.last.Type == EventRemoved {
+		return
+	}
+	e.last = ev
+	removed := ev.Type == EventRemoved
+	for sub := range e.subs {
+		sub.queue = append(sub.queue, ev)
+		sub.closed = removed
+		select {
+		case sub.ready <- struct{}{}:
+		default:
+		}
+	}
+	if removed {
+		e.subs = nil
+	}
+}
@@ -0,0 +1,107 @@
+package tjob_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob"
+)
+
+func TestJobEvents(t *testing.T) {
+	t.Parallel()
+
+	job := tjob.NewJob("true")
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	// all subscribers start with the last event
+	subs := []<-chan tjob.Event{job.Events(ctx), job.Events(ctx)}
+	for _, sub := range subs {
+		select {
+		case ev := <-sub:
+			if ev.Type != tjob.EventCreated || ev.Time.IsZero() {
+				t.Errorf("expected created event: %+v", ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected created event")
+		}
+	}
+
+	// subscribers close and unsubscribe once cancelled
+	cancel()
+	for _, sub := range subs {
+		select {
+		case ev, ok := <-sub:
+			if ok {
+				t.Errorf("unexpected event: %+v", ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected closed events")
+		}
+	}
+	if n := job.Subscribers(); n != 0 {
+		t.Errorf("expected subscribers(%d) == 0", n)
+	}
+}
+
+func TestJobEventsSlow(t *testing.T) {
+	t.Parallel()
+
+	job := tjob.NewJob("true")
+	sub := job.Events(context.TODO())
+
+	// subscriber reading only once the job was removed still gets all events
+	for range 100 {
+		job.Emit(tjob.Event{Type: tjob.EventPaused})
+	}
+	job.Emit(tjob.Event{Type: tjob.EventExited, Exit: 3})
+	job.Emit(tjob.Event{Type: tjob.EventRemoved})
+
+	var types []string
+	for ev := range sub {
+		types = append(types, ev.Type)
+	}
+	if n := len(types); n != 103 || types[0] != tjob.EventCreated || types[n-2] != tjob.EventExited || types[n-1] != tjob.EventRemoved {
+		t.Errorf("expected created, 100 paused, exited and removed events: %d %v", n, types[max(n-2, 0):])
+	}
+}
+
+func TestJobPauseNotRunning(t *testing.T) {
+	t.Parallel()
+
+	job := tjob.NewJob("true")
+	if err := job.Pause(); !errors.Is(err, tjob.ErrNotRunning) {
+		t.Errorf("expected err(%v) == %v", err, tjob.ErrNotRunning)
+	}
+	if err := job.Resume(); !errors.Is(err, tjob.ErrNotRunning) {
+		t.Errorf("expected err(%v) == %v", err, tjob.ErrNotRunning)
+	}
+}
+
+func TestJobRemove(t *testing.T) {
+	t.Parallel()
+
+	job := tjob.NewJob("true")
+	sub := job.Events(context.TODO())
+	<-sub
+
+	if err := job.Remove(false); err != nil {
+		t.Fatalf("unexpected remove: %v", err)
+	}
+	if ev := <-sub; ev.Type != tjob.EventRemoved {
+		t.Errorf("expected removed event: %+v", ev)
+	}
+	if _, ok := <-sub; ok {
+		t.Error("expected closed events")
+	}
+	if err := job.Wait(); !errors.Is(err, tjob.ErrRemoved) {
+		t.Errorf("expected err(%v) == %v", err, tjob.ErrRemoved)
+	}
+	if _, err := job.Logs(context.TODO()); !errors.Is(err, tjob.ErrRemoved) {
+		t.Errorf("expected err(%v) == %v", err, tjob.ErrRemoved)
+	}
+	if err := job.Remove(true); !errors.Is(err, tjob.ErrRemoved) {
+		t.Errorf("expected err(%v) == %v", err, tjob.ErrRemoved)
+	}
+}
@@ -0,0 +1,42 @@
+package tjob
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// InitReportErr returns the error Start returns once the jail reports the op
+// and errno
+func InitReportErr(op string, errno syscall.Errno, msg string) error {
+	return initReport{Op: op, Errno: int(errno), Msg: msg}.err()
+}
+
+// Handshake returns the error the jail reported over the sync pipe
+var Handshake = handshake //nolint:gochecknoglobals
+
+// ReadExit returns the exit code and signal the jail left next to the logs
+var ReadExit = readExit //nolint:gochecknoglobals
+
+// Emit sends the event to all subscribers of the job
+func (j *Job) Emit(ev Event) {
+	j.events.emit(ev)
+}
+
+// Subscribers returns the number of subscribers of the events of the job
+func (j *Job) Subscribers() int {
+	j.events.mu.Lock()
+	defer j.events.mu.Unlock()
+	return len(j.events.subs)
+}
+
+// CleanLogs removes the log files of orphans, leaving their cgroups alone
+var CleanLogs = cleanLogs //nolint:gochecknoglobals
+
+// CgroupRoot under which jobs get their cgroups
+const CgroupRoot = cgroupRoot
+
+// NewLogWriter returns the writer of the logs of a job to the file without limit
+func NewLogWriter(file *os.File, framed bool) io.WriteCloser {
+	return &logWriter{file: file, framed: framed}
+}
@@ -0,0 +1,198 @@
+package tjob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// health of the job
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// actions once unhealthy
+const (
+	OnUnhealthyNone    = ""
+	OnUnhealthyRestart = "restart"
+	OnUnhealthyStop    = "stop"
+)
+
+const (
+	// default time between probes
+	healthInterval = 10 * time.Second
+	// default time for each probe
+	healthTimeout = 5 * time.Second
+	// default consecutive failures until unhealthy
+	healthRetries = 3
+)
+
+// MinHealthPeriod is the least Interval and Timeout of a HealthCheck
+const MinHealthPeriod = time.Second
+
+var (
+	ErrInvalidHealthCheck = errors.New("invalid health check")
+	ErrUnhealthy          = errors.New("unhealthy")
+)
+
+// HealthCheck probes a long-running job for its Health with either Cmd or Port
+type HealthCheck struct {
+	// Cmd executed inside the job namespaces is healthy on exit 0
+	Cmd []string
+
+	// Port on the job loopback is healthy once it accepts TCP connections
+	Port int
+
+	// HTTPPath on Port is healthy on any 2xx or 3xx response instead
+	HTTPPath string
+
+	// Interval between probes of at least MinHealthPeriod unless zero for the default
+	Interval time.Duration
+
+	// Timeout of each probe of at least MinHealthPeriod unless zero for the default
+	Timeout time.Duration
+
+	// Retries is the consecutive failures until unhealthy unless zero for the default
+	Retries int
+
+	// OnUnhealthy is one of none (default), restart, or stop
+	OnUnhealthy string
+}
+
+// Validate returns ErrInvalidHealthCheck unless probing exactly one of Cmd or Port
+func (h *HealthCheck) Validate() error {
+	switch {
+	case (len(h.Cmd) > 0) == (h.Port > 0):
+		return fmt.Errorf("%w: requires either cmd or port", ErrInvalidHealthCheck)
+	case h.HTTPPath != "" && h.Port <= 0:
+		return fmt.Errorf("%w: http path requires port", ErrInvalidHealthCheck)
+	case h.Port > 65535:
+		return fmt.Errorf("%w: port %d", ErrInvalidHealthCheck, h.Port)
+	case h.Interval < 0 || h.Timeout < 0 || h.Retries < 0:
+		return fmt.Errorf("%w: negative interval, timeout or retries", ErrInvalidHealthCheck)
+	case h.Interval > 0 && h.Interval < MinHealthPeriod, h.Timeout > 0 && h.Timeout < MinHealthPeriod:
+		return fmt.Errorf("%w: interval or timeout under %v", ErrInvalidHealthCheck, MinHealthPeriod)
+	}
+	switch h.OnUnhealthy {
+	case OnUnhealthyNone, OnUnhealthyRestart, OnUnhealthyStop:
+		return nil
+	default:
+		return fmt.Errorf("%w: on unhealthy %s", ErrInvalidHealthCheck, h.OnUnhealthy)
+	}
+}
+
+// probe runs a single probe against the job with pid in cgroup within the timeout
+func (h *HealthCheck) probe(pid int, cgroup string) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = healthTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if len(h.Cmd) > 0 {
+		return probeCmd(ctx, pid, cgroup, h.Cmd)
+	}
+	conn, err := probeDial(ctx, pid, h.Port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if h.HTTPPath == "" {
+		return nil
+	}
+
+	// send the request over the connection dialed inside the job
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext:       singleDial(conn),
+			DisableKeepAlives: true,
+		},
+		// redirects count as healthy
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	url := fmt.Sprintf("http://localhost:%d%s", h.Port, h.HTTPPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("probe: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("probe: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("probe: %w: %s", ErrUnhealthy, resp.Status)
+	}
+	return nil
+}
+
+// monitor probes the running attempt of the job every interval until done and
+// acts on it once unhealthy
+func (j *Job) monitor() {
+	h := j.HealthCheck
+	interval, retries := h.Interval, h.Retries
+	if interval <= 0 {
+		interval = healthInterval
+	}
+	if retries <= 0 {
+		retries = healthRetries
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures, pid := 0, 0
+	for {
+		select {
+		case <-j.doneCh:
+			return
+		case <-ticker.C:
+		}
+
+		// skip probes between attempts and start over for each attempt
+		j.rw.RLock()
+		running, attempt := j.attempt.StoppedAt.IsZero(), j.attempt.Pid
+		j.rw.RUnlock()
+		if !running {
+			continue
+		}
+		if attempt != pid {
+			failures, pid = 0, attempt
+		}
+
+		if err := h.probe(pid, cgroupOf(j.Id)); err == nil {
+			failures = 0
+			j.setHealth(pid, HealthHealthy)
+			continue
+		}
+		if failures++; failures < retries {
+			continue
+		}
+		j.setHealth(pid, HealthUnhealthy)
+
+		switch h.OnUnhealthy {
+		case OnUnhealthyRestart:
+			failures = 0
+			_ = j.restart()
+		case OnUnhealthyStop:
+			_ = j.terminate(ErrUnhealthy)
+			return
+		}
+	}
+}
+
+// setHealth sets the health unless pid is no longer the running attempt
+func (j *Job) setHealth(pid int, health string) {
+	j.rw.Lock()
+	defer j.rw.Unlock()
+
+	if j.attempt.Pid == pid && j.attempt.StoppedAt.IsZero() {
+		j.status.Health = health
+	}
+}
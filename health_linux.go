@@ -0,0 +1,129 @@
+package tjob
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// namespaces entered by probes
+var probeNamespaces = []struct { //nolint:gochecknoglobals
+	name string
+	flag int
+}{
+	{"net", unix.CLONE_NEWNET},
+	{"pid", unix.CLONE_NEWPID},
+	{"mnt", unix.CLONE_NEWNS},
+}
+
+// enter moves the calling thread into the namespaces of pid. The thread must
+// stay locked and exit with its goroutine to never run anything else.
+func enter(pid int) error {
+	runtime.LockOSThread()
+	// threads of the go runtime share their root and cwd unless unshared,
+	// which the mount namespace cannot be entered with
+	if err := unix.Unshare(unix.CLONE_FS); err != nil {
+		return fmt.Errorf("unshare fs: %w", err)
+	}
+	for _, ns := range probeNamespaces {
+		path := fmt.Sprintf("/proc/%d/ns/%s", pid, ns.name)
+		fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		err = unix.Setns(fd, ns.flag)
+		unix.Close(fd)
+		if err != nil {
+			return fmt.Errorf("setns %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// probeCmd runs the command inside the namespaces of pid and its cgroup, and
+// fails unless exit 0
+func probeCmd(ctx context.Context, pid int, cgroup string, args []string) error {
+	// opened in the mount namespace of the server before entering that of the job
+	dir, err := os.Open(cgroup)
+	if err != nil {
+		return fmt.Errorf("probe: %w", err)
+	}
+	defer dir.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		if err := enter(pid); err != nil {
+			errCh <- err
+			return
+		}
+		// fork from this thread for the command to inherit its namespaces
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.SysProcAttr = &syscall.SysProcAttr{CgroupFD: int(dir.Fd()), UseCgroupFD: true}
+		if err := cmd.Run(); err != nil {
+			errCh <- fmt.Errorf("probe: %w", err)
+			return
+		}
+		errCh <- nil
+	}()
+	return <-errCh
+}
+
+// probeDial connects to port on the loopback inside the network namespace of pid
+func probeDial(ctx context.Context, pid, port int) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		if err := enter(pid); err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		// the socket belongs to the namespace of the thread creating it
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			err = fmt.Errorf("probe: %w", err)
+		}
+		resultCh <- result{conn: conn, err: err}
+	}()
+	r := <-resultCh
+	return r.conn, r.err
+}
+
+// singleDial returns the already dialed conn to an http.Transport
+func singleDial(conn net.Conn) func(context.Context, string, string) (net.Conn, error) {
+	return func(context.Context, string, string) (net.Conn, error) {
+		return conn, nil
+	}
+}
+
+// loopback brings up the loopback interface of the new network namespace
+func loopback() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	ifreq, err := unix.NewIfreq("lo")
+	if err != nil {
+		return fmt.Errorf("lo: %w", err)
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifreq); err != nil {
+		return fmt.Errorf("lo flags: %w", err)
+	}
+	ifreq.SetUint16(ifreq.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifreq); err != nil {
+		return fmt.Errorf("lo up: %w", err)
+	}
+	return nil
+}
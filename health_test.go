@@ -0,0 +1,143 @@
+package tjob_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob"
+)
+
+func TestHealthCheckValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		check tjob.HealthCheck
+		err   error
+	}{
+		{"cmd", tjob.HealthCheck{Cmd: []string{"true"}}, nil},
+		{"tcp", tjob.HealthCheck{Port: 8080}, nil},
+		{"http", tjob.HealthCheck{Port: 8080, HTTPPath: "/healthz", OnUnhealthy: tjob.OnUnhealthyRestart}, nil},
+		{"none", tjob.HealthCheck{}, tjob.ErrInvalidHealthCheck},
+		{"both", tjob.HealthCheck{Cmd: []string{"true"}, Port: 8080}, tjob.ErrInvalidHealthCheck},
+		{"http without port", tjob.HealthCheck{Cmd: []string{"true"}, HTTPPath: "/"}, tjob.ErrInvalidHealthCheck},
+		{"bad port", tjob.HealthCheck{Port: 70000}, tjob.ErrInvalidHealthCheck},
+		{"bad action", tjob.HealthCheck{Port: 8080, OnUnhealthy: "panic"}, tjob.ErrInvalidHealthCheck},
+		{"least interval", tjob.HealthCheck{Port: 8080, Interval: time.Second, Timeout: time.Second}, nil},
+		{"short interval", tjob.HealthCheck{Port: 8080, Interval: time.Millisecond}, tjob.ErrInvalidHealthCheck},
+		{"short timeout", tjob.HealthCheck{Port: 8080, Timeout: 999 * time.Millisecond}, tjob.ErrInvalidHealthCheck},
+	}
+	for _, test := range tests {
+		if err := test.check.Validate(); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected err(%v) == %v", test.name, err, test.err)
+		}
+	}
+}
+
+// healthy returns the jailed job probed healthy while the file exists
+func healthy(t *testing.T, initPath, file, onUnhealthy string) *tjob.Job {
+	t.Helper()
+
+	job := jailed(t, initPath, "sleep", "30")
+	job.HealthCheck = &tjob.HealthCheck{
+		Cmd:         []string{"test", "-f", file},
+		Interval:    time.Second,
+		Timeout:     time.Second,
+		Retries:     2,
+		OnUnhealthy: onUnhealthy,
+	}
+	if err := job.Start(context.Background()); err != nil {
+		t.Fatalf("unexpected start: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = job.Stop()
+		_ = job.Wait()
+	})
+	return job
+}
+
+// awaitHealth waits up to timeout for the health of the job
+func awaitHealth(t *testing.T, job *tjob.Job, health string, timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for job.Status().Health != health && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := job.Status().Health; got != health {
+		t.Fatalf("expected health(%s) == %s", got, health)
+	}
+}
+
+func TestJobHealth(t *testing.T) {
+	initPath := requireJail(t)
+	file := filepath.Join(t.TempDir(), "healthy")
+	sut := healthy(t, initPath, file, tjob.OnUnhealthyNone)
+
+	// still starting after the first failure, unhealthy after the second
+	time.Sleep(1500 * time.Millisecond)
+	if health := sut.Status().Health; health != tjob.HealthStarting {
+		t.Errorf("expected health(%s) == %s", health, tjob.HealthStarting)
+	}
+	awaitHealth(t, sut, tjob.HealthUnhealthy, 2*time.Second)
+
+	// recovers on the next success and keeps running without any action
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatalf("unexpected file: %v", err)
+	}
+	awaitHealth(t, sut, tjob.HealthHealthy, 2*time.Second)
+	if status := sut.Status(); status.Stopped() || status.Restarts != 0 {
+		t.Errorf("expected running without restarts: %+v", status)
+	}
+
+	// unhealthy again only after consecutive failures
+	if err := os.Remove(file); err != nil {
+		t.Fatalf("unexpected remove: %v", err)
+	}
+	awaitHealth(t, sut, tjob.HealthUnhealthy, 3*time.Second)
+}
+
+func TestJobHealthRestart(t *testing.T) {
+	initPath := requireJail(t)
+	sut := healthy(t, initPath, filepath.Join(t.TempDir(), "healthy"), tjob.OnUnhealthyRestart)
+
+	// restarted once unhealthy despite the default restart policy of never
+	deadline := time.Now().Add(10 * time.Second)
+	for sut.Status().Restarts == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	status := sut.Status()
+	if status.Restarts == 0 || status.Stopped() {
+		t.Fatalf("expected restarted and running: %+v", status)
+	}
+	if len(status.Attempts) == 0 || status.Attempts[0].Exit != 128+int32(syscall.SIGTERM) {
+		t.Errorf("expected first attempt terminated: %+v", status.Attempts)
+	}
+	// probed from the start again for the next attempt
+	if status.Health == tjob.HealthUnhealthy {
+		t.Errorf("expected health(%s) != %s", status.Health, tjob.HealthUnhealthy)
+	}
+}
+
+func TestJobHealthStop(t *testing.T) {
+	initPath := requireJail(t)
+	sut := healthy(t, initPath, filepath.Join(t.TempDir(), "healthy"), tjob.OnUnhealthyStop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sut.WaitContext(ctx); err != nil && !sut.Done() {
+		t.Fatalf("expected stopped: %v", err)
+	}
+	status := sut.Status()
+	if !errors.Is(status.Error, tjob.ErrUnhealthy) || status.Reason() != "unhealthy" {
+		t.Errorf("expected err(%v) == %v", status.Error, tjob.ErrUnhealthy)
+	}
+	if status.Health != tjob.HealthUnhealthy || status.Restarts != 0 {
+		t.Errorf("expected unhealthy without restarts: %+v", status)
+	}
+}
@@ -0,0 +1,312 @@
+// Package journal persists the jobs of tjobs as an append-only journal of
+// JSON records compacted on open and once mostly outdated.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/neildo/tjob"
+)
+
+// operations of records
+const (
+	OpRun    = "run"
+	OpStatus = "status"
+	OpRemove = "remove"
+)
+
+const (
+	fileName = "journal.jsonl"
+	dirMode  = 0o700
+	fileMode = 0o600
+
+	// least records appended before compacting the journal while open, and
+	// then only once more than compactRatio times the records of jobs kept
+	compactMin   = 1024
+	compactRatio = 4
+)
+
+type (
+	// Record of a job in the journal
+	Record struct {
+		Op   string    `json:"op"`
+		ID   string    `json:"id"`
+		Time time.Time `json:"time"`
+
+		// spec and owner of the job once run
+		JobID     string            `json:"job_id,omitempty"` // naming its cgroup
+		User      string            `json:"user,omitempty"`
+		Path      string            `json:"path,omitempty"`
+		Args      []string          `json:"args,omitempty"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		LogPath   string            `json:"log_path,omitempty"`
+		LogFormat string            `json:"log_format,omitempty"` // raw unless framed
+		LogLimit  int64             `json:"log_limit,omitempty"`  // bytes of logs kept unless 0
+
+		// Status of the job once changed
+		Status *Status `json:"status,omitempty"`
+	}
+
+	// Status of the job as tjob.Status with its error as text
+	Status struct {
+		Pid       int            `json:"pid,omitempty"`
+		Cmd       string         `json:"cmd"`
+		StartedAt time.Time      `json:"started_at"`
+		StoppedAt time.Time      `json:"stopped_at"`
+		Exit      int32          `json:"exit"`
+		Error     string         `json:"error,omitempty"`
+		Reason    string         `json:"reason,omitempty"`
+		Restarts  int            `json:"restarts,omitempty"`
+		Attempts  []tjob.Attempt `json:"attempts,omitempty"`
+		Health    string         `json:"health,omitempty"`
+		Truncated bool           `json:"truncated,omitempty"`
+	}
+
+	// stopError keeps the text of the error and the reason the job stopped
+	stopError struct {
+		msg    string
+		reason error
+	}
+
+	// jobs keeps the latest record of each job not removed in the order run
+	jobs struct {
+		order  []string
+		latest map[string]*Record
+	}
+
+	// Journal appends records to the file in its state directory
+	Journal struct {
+		mu   sync.Mutex
+		path string
+		file *os.File
+		jobs jobs
+		// records in the file
+		records int
+		// true once read from an earlier run
+		replayed bool
+	}
+)
+
+// Open compacts the journal in dir and returns it with the run record of each
+// job not removed, with its latest Status, in the order run
+func Open(dir string) (*Journal, []Record, error) {
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return nil, nil, fmt.Errorf("journal: %w", err)
+	}
+	j := &Journal{path: filepath.Join(dir, fileName), jobs: jobs{latest: make(map[string]*Record)}}
+	if err := j.replay(); err != nil {
+		return nil, nil, err
+	}
+	if err := j.compact(); err != nil {
+		return nil, nil, err
+	}
+	return j, j.jobs.records(), nil
+}
+
+// replay reads the journal into the latest record of each job, skipping any
+// record torn by a crash
+func (j *Journal) replay() error {
+	file, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	defer file.Close()
+	j.replayed = true
+
+	reader := bufio.NewReader(file)
+	for {
+		// records of any size unlike bufio.Scanner
+		line, err := reader.ReadBytes('\n')
+		var r Record
+		if len(line) > 0 && json.Unmarshal(line, &r) == nil {
+			j.jobs.apply(r)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("journal: %w", err)
+		}
+	}
+}
+
+// compact rewrites the journal with the latest record of each job and appends
+// to it from then on
+func (j *Journal) compact() error {
+	records := j.jobs.records()
+	tmp := j.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode)
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	for _, r := range records {
+		b, err := json.Marshal(r)
+		if err == nil {
+			_, err = writer.Write(append(b, '\n'))
+		}
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("journal: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("journal: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		file.Close()
+		return fmt.Errorf("journal: %w", err)
+	}
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, j.records = file, len(records)
+	return nil
+}
+
+// Append writes the record to the journal and syncs it to disk, compacting
+// the journal once mostly made of records outdated by later ones
+func (j *Journal) Append(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	j.jobs.apply(r)
+	if j.records++; j.records > compactMin && j.records > compactRatio*len(j.jobs.latest) {
+		return j.compact()
+	}
+	return nil
+}
+
+// Replayed returns true if the journal was left by an earlier run instead of
+// created on Open
+func (j *Journal) Replayed() bool {
+	return j.replayed
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	return nil
+}
+
+// apply keeps the record as the latest of its job
+func (s *jobs) apply(r Record) {
+	switch r.Op {
+	case OpRun:
+		if _, ok := s.latest[r.ID]; !ok {
+			s.order = append(s.order, r.ID)
+		}
+		s.latest[r.ID] = &r
+	case OpStatus:
+		if job, ok := s.latest[r.ID]; ok {
+			job.Status = r.Status
+		}
+	case OpRemove:
+		delete(s.latest, r.ID)
+	}
+}
+
+// records returns the run record of each job not removed, with its latest
+// Status, in the order run, dropping the ids of those removed
+func (s *jobs) records() []Record {
+	records := make([]Record, 0, len(s.latest))
+	order := s.order[:0]
+	for _, id := range s.order {
+		if job, ok := s.latest[id]; ok {
+			records = append(records, *job)
+			order = append(order, id)
+		}
+	}
+	s.order = order
+	return records
+}
+
+// StatusOf returns the Status of the tjob.Status
+func StatusOf(status tjob.Status) *Status {
+	out := &Status{
+		Pid:       status.Pid,
+		Cmd:       status.Cmd,
+		StartedAt: status.StartedAt,
+		StoppedAt: status.StoppedAt,
+		Exit:      status.Exit,
+		Reason:    status.Reason(),
+		Restarts:  status.Restarts,
+		Attempts:  status.Attempts,
+		Health:    status.Health,
+		Truncated: status.Truncated,
+	}
+	if status.Error != nil {
+		out.Error = status.Error.Error()
+	}
+	return out
+}
+
+// Restore returns the tjob.Status of the Status
+func (s *Status) Restore() tjob.Status {
+	out := tjob.Status{
+		Pid:       s.Pid,
+		Cmd:       s.Cmd,
+		StartedAt: s.StartedAt,
+		StoppedAt: s.StoppedAt,
+		Exit:      s.Exit,
+		Restarts:  s.Restarts,
+		Attempts:  s.Attempts,
+		Health:    s.Health,
+		Truncated: s.Truncated,
+	}
+	if s.StoppedAt.After(s.StartedAt) {
+		out.Ran = s.StoppedAt.Sub(s.StartedAt)
+	}
+	if s.Error != "" {
+		out.Error = &stopError{msg: s.Error, reason: reasons[s.Reason]}
+	}
+	return out
+}
+
+// reasons of tjob.Status.Reason by their error
+var reasons = map[string]error{ //nolint:gochecknoglobals
+	"timed out": tjob.ErrTimedOut,
+	"stopped":   tjob.ErrForceStop,
+	"unhealthy": tjob.ErrUnhealthy,
+	"log limit": tjob.ErrLogLimit,
+}
+
+func (e *stopError) Error() string {
+	return e.msg
+}
+
+// Is matches the error of the reason the job stopped
+func (e *stopError) Is(target error) bool {
+	return e.reason != nil && errors.Is(e.reason, target)
+}
@@ -0,0 +1,169 @@
+package journal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob/internal/journal"
+)
+
+// write leaves the journal in dir with the records and then the raw tail
+func write(t *testing.T, dir string, tail string, records ...journal.Record) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, r := range records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("unexpected record: %v", err)
+		}
+		buf.Write(append(b, '\n'))
+	}
+	buf.WriteString(tail)
+	if err := os.WriteFile(filepath.Join(dir, "journal.jsonl"), buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("unexpected journal: %v", err)
+	}
+}
+
+// ids returns the id of each record with the cmd of its status if any
+func ids(records []journal.Record) string {
+	var out []string
+	for _, r := range records {
+		if r.Status != nil {
+			out = append(out, r.ID+":"+r.Status.Cmd)
+			continue
+		}
+		out = append(out, r.ID)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 2<<20)
+	tests := []struct {
+		name    string
+		records []journal.Record
+		tail    string
+		out     string
+	}{
+		{"empty", nil, "", ""},
+		{
+			"latest status",
+			[]journal.Record{
+				{Op: journal.OpRun, ID: "a"},
+				{Op: journal.OpRun, ID: "b"},
+				{Op: journal.OpStatus, ID: "a", Status: &journal.Status{Cmd: "1"}},
+				{Op: journal.OpStatus, ID: "a", Status: &journal.Status{Cmd: "2"}},
+				{Op: journal.OpStatus, ID: "c", Status: &journal.Status{Cmd: "3"}},
+			},
+			"",
+			"a:2 b",
+		},
+		{
+			"removed",
+			[]journal.Record{
+				{Op: journal.OpRun, ID: "a"},
+				{Op: journal.OpRun, ID: "b"},
+				{Op: journal.OpRemove, ID: "a"},
+			},
+			"",
+			"b",
+		},
+		{
+			"torn record",
+			[]journal.Record{{Op: journal.OpRun, ID: "a"}},
+			`{"op":"remove","id":"a","ti`,
+			"a",
+		},
+		{
+			"torn record in between",
+			[]journal.Record{{Op: journal.OpRun, ID: "a"}},
+			"{\"op\":\"run\",\"id\":\"b\"\n{\"op\":\"run\",\"id\":\"c\"}\n",
+			"a c",
+		},
+		{
+			"long record",
+			[]journal.Record{
+				{Op: journal.OpRun, ID: "a", Args: []string{long}},
+				{Op: journal.OpRun, ID: "b"},
+			},
+			"",
+			"a b",
+		},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		write(t, dir, test.tail, test.records...)
+
+		sut, records, err := journal.Open(dir)
+		if err != nil {
+			t.Fatalf("%s: unexpected open: %v", test.name, err)
+		}
+		if out := ids(records); out != test.out {
+			t.Errorf("%s: expected records(%s) == %s", test.name, out, test.out)
+		}
+		sut.Close()
+
+		// same records once compacted
+		sut, records, err = journal.Open(dir)
+		if err != nil {
+			t.Fatalf("%s: unexpected reopen: %v", test.name, err)
+		}
+		if out := ids(records); out != test.out {
+			t.Errorf("%s: expected compacted records(%s) == %s", test.name, out, test.out)
+		}
+		sut.Close()
+	}
+}
+
+func TestAppendCompacts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	sut, _, err := journal.Open(dir)
+	if err != nil {
+		t.Fatalf("unexpected open: %v", err)
+	}
+	defer sut.Close()
+	if sut.Replayed() {
+		t.Error("expected new journal")
+	}
+
+	// status changes of a few jobs outdating all but the latest
+	for i := range 3000 {
+		id := string(rune('a' + i%3))
+		r := journal.Record{Op: journal.OpStatus, ID: id, Status: &journal.Status{Cmd: id, StoppedAt: time.Now()}}
+		if i < 3 {
+			r.Op = journal.OpRun
+		}
+		if err := sut.Append(r); err != nil {
+			t.Fatalf("unexpected append: %v", err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "journal.jsonl"))
+	if err != nil {
+		t.Fatalf("unexpected journal: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 1100 {
+		t.Errorf("expected lines(%d) <= 1100 once compacted", lines)
+	}
+
+	reopened, records, err := journal.Open(dir)
+	if err != nil {
+		t.Fatalf("unexpected reopen: %v", err)
+	}
+	defer reopened.Close()
+	if !reopened.Replayed() {
+		t.Error("expected replayed journal")
+	}
+	if out := ids(records); out != "a:a b:b c:c" {
+		t.Errorf("expected records(%s) == a:a b:b c:c", out)
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/neildo/tjob"
+	"github.com/neildo/tjob/internal/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// default JobServer.LogChunk
+	defaultLogChunk = 64 * 1024
+
+	// least bytes of raw logs read at once, doubling up to the chunk while
+	// reads fill it and halving while they fill less than half of it
+	minLogChunk = 1024
+)
+
+// chunk of the logs at the offset in all logs ever written, with the time and
+// stream of its output if framed
+type chunk struct {
+	out          []byte
+	offset, next int64
+	framed       bool
+	time         time.Time
+	stream       int
+}
+
+// joins returns true if the chunk c continues the chunk within size bytes, and
+// within latency of its time if framed. Framed chunks joined keep the time of
+// the first, so the output of those after is sent as written up to latency
+// earlier than it was.
+func (c *chunk) joins(next chunk, size int, latency time.Duration) bool {
+	if c.next != next.offset || len(c.out)+len(next.out) > size {
+		return false
+	}
+	return !c.framed || next.stream == c.stream && next.time.Sub(c.time) <= latency
+}
+
+// response returns the LogsResponse of the chunk
+func (c *chunk) response() *proto.LogsResponse {
+	out := &proto.LogsResponse{Out: c.out, Offset: c.offset, NextOffset: c.next}
+	if c.framed {
+		out.Time, out.Stream = timestamppb.New(c.time), streams[c.stream]
+	}
+	return out
+}
+
+// sendLogs sends the logs of the job selected by opts in chunks up to LogChunk
+// bytes, coalescing those read within LogLatency of the first. Reads wait for
+// each send, blocked by the flow control of the stream, instead of buffering.
+func (s *JobServer) sendLogs(ctx context.Context, job *tjob.Job, opts tjob.LogOptions, stream grpc.ServerStreamingServer[proto.LogsResponse]) error {
+	// stop reading before closing the logs once sent or failed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	logs, err := job.LogsWith(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("logs: %w", err)
+	}
+	defer func() { logs.Close() }()
+
+	// tell clients the logs opened to reconnect to them if cut off later
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return fmt.Errorf("stream send: %w", err)
+	}
+
+	size := s.LogChunk
+	if size <= 0 {
+		size = defaultLogChunk
+	}
+	chunks := make(chan chunk)
+	go func() {
+		defer close(chunks)
+		if job.LogFormat == tjob.LogFramed {
+			err = readRecords(ctx, logs, chunks)
+		} else {
+			err = readChunks(ctx, logs, size, chunks)
+		}
+	}()
+	if err := s.coalesce(chunks, size, stream); err != nil {
+		// drain until reads stop
+		cancel()
+		for range chunks {
+		}
+		return err
+	}
+	// read error once chunks closed
+	return err
+}
+
+// coalesce sends the chunks joined up to size bytes within LogLatency
+func (s *JobServer) coalesce(chunks <-chan chunk, size int, stream grpc.ServerStreamingServer[proto.LogsResponse]) error {
+	var (
+		batch   *chunk
+		timeout <-chan time.Time
+	)
+	flush := func() error {
+		if batch == nil {
+			return nil
+		}
+		out := batch.response()
+		batch, timeout = nil, nil
+		if err := stream.Send(out); err != nil {
+			return fmt.Errorf("stream send: %w", err)
+		}
+		return nil
+	}
+	for {
+		select {
+		case c, ok := <-chunks:
+			if !ok {
+				return flush()
+			}
+			if batch != nil && !batch.joins(c, size, s.LogLatency) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			if batch == nil {
+				batch = &c
+				if s.LogLatency > 0 {
+					timeout = time.After(s.LogLatency)
+				}
+			} else {
+				batch.out, batch.next = append(batch.out, c.out...), c.next
+			}
+			if len(batch.out) >= size || s.LogLatency <= 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-timeout:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readChunks reads raw logs in chunks growing up to size while output keeps up
+// until EOF or done
+func readChunks(ctx context.Context, logs *tjob.JobReader, size int, chunks chan<- chunk) error {
+	least := min(minLogChunk, size)
+	read := least
+	for {
+		buffer := make([]byte, read)
+		n, err := logs.Read(buffer)
+		if n > 0 {
+			next := logs.Offset()
+			if !emit(ctx, chunks, chunk{out: buffer[:n], offset: next - int64(n), next: next}) {
+				return nil
+			}
+			read = resized(read, n, least, size)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("log read: %w", err)
+		}
+	}
+}
+
+// resized returns the bytes to read next within least and size, doubled once
+// n bytes filled the read or halved once less than half of it
+func resized(read, n, least, size int) int {
+	switch {
+	case n == read:
+		return min(2*read, size)
+	case n < read/2:
+		return max(read/2, least)
+	}
+	return read
+}
+
+// readRecords reads framed logs in chunks of each record until EOF or done
+func readRecords(ctx context.Context, logs *tjob.JobReader, chunks chan<- chunk) error {
+	records := tjob.NewLogRecordReader(logs)
+	for {
+		record, err := records.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("log read: %w", err)
+		}
+		next := logs.Offset()
+		c := chunk{
+			out:    record.Out,
+			offset: next - record.Size(),
+			next:   next,
+			framed: true,
+			time:   record.Time,
+			stream: record.Stream,
+		}
+		if !emit(ctx, chunks, c) {
+			return nil
+		}
+	}
+}
+
+// emit passes the chunk on unless done
+func emit(ctx context.Context, chunks chan<- chunk, c chunk) bool {
+	select {
+	case chunks <- c:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob"
+	"github.com/neildo/tjob/internal/proto"
+	"google.golang.org/grpc"
+)
+
+// sentLogs fakes the stream of logs keeping all sent
+type sentLogs struct {
+	grpc.ServerStreamingServer[proto.LogsResponse]
+	sent []*proto.LogsResponse
+}
+
+func (s *sentLogs) Send(out *proto.LogsResponse) error {
+	s.sent = append(s.sent, out)
+	return nil
+}
+
+// readerOf returns the reader of the logs of a stopped job in the format
+func readerOf(t *testing.T, logs []byte, format string) *tjob.JobReader {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "output.log")
+	if err := os.WriteFile(path, logs, 0o600); err != nil {
+		t.Fatalf("unexpected logs: %v", err)
+	}
+	now := time.Now()
+	job := tjob.RestoreJob("abc", tjob.Status{Cmd: "echo", StartedAt: now, StoppedAt: now}, path)
+	job.LogFormat = format
+	reader, err := job.LogsWith(context.TODO(), tjob.LogOptions{})
+	if err != nil {
+		t.Fatalf("unexpected logs: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	return reader
+}
+
+// collect returns the chunks read until closed
+func collect(read func(chan<- chunk) error) ([]chunk, error) {
+	chunks := make(chan chunk)
+	var err error
+	go func() {
+		defer close(chunks)
+		err = read(chunks)
+	}()
+	var out []chunk
+	for c := range chunks {
+		out = append(out, c)
+	}
+	return out, err
+}
+
+func TestJoins(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	raw := chunk{out: []byte("ab"), offset: 0, next: 2}
+	framed := chunk{out: []byte("ab"), offset: 0, next: 15, framed: true, time: now, stream: tjob.Stdout}
+	tests := []struct {
+		name  string
+		c     chunk
+		next  chunk
+		joins bool
+	}{
+		{"raw after", raw, chunk{out: []byte("cd"), offset: 2, next: 4}, true},
+		{"raw up to size", raw, chunk{out: []byte("cdef"), offset: 2, next: 6}, true},
+		{"raw beyond size", raw, chunk{out: []byte("cdefg"), offset: 2, next: 7}, false},
+		{"raw dropped between", raw, chunk{out: []byte("cd"), offset: 3, next: 5}, false},
+		{"framed within latency", framed, chunk{out: []byte("cd"), offset: 15, next: 30, framed: true, time: now.Add(time.Millisecond), stream: tjob.Stdout}, true},
+		{"framed beyond latency", framed, chunk{out: []byte("cd"), offset: 15, next: 30, framed: true, time: now.Add(time.Second), stream: tjob.Stdout}, false},
+		{"framed of another stream", framed, chunk{out: []byte("cd"), offset: 15, next: 30, framed: true, time: now, stream: tjob.Stderr}, false},
+		{"framed dropped between", framed, chunk{out: []byte("cd"), offset: 30, next: 45, framed: true, time: now, stream: tjob.Stdout}, false},
+	}
+	for _, test := range tests {
+		if joins := test.c.joins(test.next, 6, 10*time.Millisecond); joins != test.joins {
+			t.Errorf("%s: expected joins(%v) == %v", test.name, joins, test.joins)
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	raw := func(out string, offset int64) chunk {
+		return chunk{out: []byte(out), offset: offset, next: offset + int64(len(out))}
+	}
+	framed := func(out string, offset int64, stream int, after time.Duration) chunk {
+		next := offset + 13 + int64(len(out))
+		return chunk{out: []byte(out), offset: offset, next: next, framed: true, time: now.Add(after), stream: stream}
+	}
+	tests := []struct {
+		name    string
+		latency time.Duration
+		chunks  []chunk
+		// sent as out, offset and next, joined by | each
+		sent []string
+	}{
+		{"each without latency", 0, []chunk{raw("ab", 0), raw("cd", 2)}, []string{"ab 0 2", "cd 2 4"}},
+		{"joined within latency", time.Minute, []chunk{raw("ab", 0), raw("cd", 2)}, []string{"abcd 0 4"}},
+		{"flushed once of size", time.Minute, []chunk{raw("abc", 0), raw("def", 3), raw("g", 6)}, []string{"abcdef 0 6", "g 6 7"}},
+		{"split beyond size", time.Minute, []chunk{raw("abcd", 0), raw("efg", 4)}, []string{"abcd 0 4", "efg 4 7"}},
+		{"split where dropped", time.Minute, []chunk{raw("ab", 0), raw("cd", 5)}, []string{"ab 0 2", "cd 5 7"}},
+		{
+			"framed by stream", time.Minute,
+			[]chunk{framed("a", 0, tjob.Stdout, 0), framed("b", 14, tjob.Stdout, time.Millisecond), framed("c", 28, tjob.Stderr, time.Millisecond)},
+			[]string{"ab 0 28", "c 28 42"},
+		},
+		{
+			"framed by latency", 10 * time.Millisecond,
+			[]chunk{framed("a", 0, tjob.Stdout, 0), framed("b", 14, tjob.Stdout, time.Second)},
+			[]string{"a 0 14", "b 14 28"},
+		},
+	}
+	for _, test := range tests {
+		chunks := make(chan chunk, len(test.chunks))
+		for _, c := range test.chunks {
+			chunks <- c
+		}
+		close(chunks)
+		stream := &sentLogs{}
+		s := &JobServer{LogLatency: test.latency}
+		if err := s.coalesce(chunks, 6, stream); err != nil {
+			t.Errorf("%s: unexpected coalesce: %v", test.name, err)
+			continue
+		}
+		var sent []string
+		for _, out := range stream.sent {
+			sent = append(sent, fmt.Sprintf("%s %d %d", out.GetOut(), out.GetOffset(), out.GetNextOffset()))
+		}
+		if !slices.Equal(sent, test.sent) {
+			t.Errorf("%s: expected sent(%q) == %q", test.name, sent, test.sent)
+		}
+		// framed joined keep the time of the first
+		if first := test.chunks[0]; first.framed && !stream.sent[0].GetTime().AsTime().Equal(first.time) {
+			t.Errorf("%s: expected time(%v) == %v", test.name, stream.sent[0].GetTime().AsTime(), first.time)
+		}
+	}
+}
+
+func TestCoalesceLatency(t *testing.T) {
+	t.Parallel()
+
+	// flushed once within latency although not of size
+	chunks := make(chan chunk)
+	stream := &sentLogs{}
+	s := &JobServer{LogLatency: 10 * time.Millisecond}
+	done := make(chan error)
+	go func() { done <- s.coalesce(chunks, 1024, stream) }()
+
+	chunks <- chunk{out: []byte("ab"), offset: 0, next: 2}
+	time.Sleep(100 * time.Millisecond)
+	chunks <- chunk{out: []byte("cd"), offset: 2, next: 4}
+	close(chunks)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected coalesce: %v", err)
+	}
+	if len(stream.sent) != 2 || string(stream.sent[0].GetOut()) != "ab" || string(stream.sent[1].GetOut()) != "cd" {
+		t.Errorf("expected sent(%v) == [ab cd]", stream.sent)
+	}
+}
+
+func TestResized(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		read, n, next int
+	}{
+		{1024, 1024, 2048},
+		{4096, 4096, 8192},
+		{8192, 8192, 8192},
+		{4096, 2048, 4096},
+		{4096, 2047, 2048},
+		{2048, 1, 1024},
+		{1024, 1, 1024},
+	}
+	for _, test := range tests {
+		if next := resized(test.read, test.n, 1024, 8192); next != test.next {
+			t.Errorf("%d of %d: expected next(%d) == %d", test.n, test.read, next, test.next)
+		}
+	}
+}
+
+func TestReadChunks(t *testing.T) {
+	t.Parallel()
+
+	// growing reads of the logs up to the size
+	logs := make([]byte, 10000)
+	reader := readerOf(t, logs, tjob.LogRaw)
+	chunks, err := collect(func(chunks chan<- chunk) error {
+		return readChunks(context.TODO(), reader, 4096, chunks)
+	})
+	if err != nil {
+		t.Fatalf("unexpected read: %v", err)
+	}
+	var sizes []int
+	next := int64(0)
+	for _, c := range chunks {
+		if c.offset != next || c.next != c.offset+int64(len(c.out)) || c.framed {
+			t.Errorf("unexpected chunk at %d: %d %d", next, c.offset, c.next)
+		}
+		sizes, next = append(sizes, len(c.out)), c.next
+	}
+	if expected := []int{1024, 2048, 4096, 2832}; !slices.Equal(sizes, expected) {
+		t.Errorf("expected sizes(%v) == %v", sizes, expected)
+	}
+}
+
+func TestReadRecords(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	var logs []byte
+	for i, out := range []string{"a\n", "bc\n"} {
+		header := make([]byte, 13)
+		binary.BigEndian.PutUint64(header, uint64(now.Add(time.Duration(i)*time.Second).UnixNano()))
+		header[8] = byte(tjob.Stdout + i)
+		binary.BigEndian.PutUint32(header[9:], uint32(len(out)))
+		logs = append(logs, append(header, out...)...)
+	}
+	reader := readerOf(t, logs, tjob.LogFramed)
+	chunks, err := collect(func(chunks chan<- chunk) error {
+		return readRecords(context.TODO(), reader, chunks)
+	})
+	if err != nil {
+		t.Fatalf("unexpected read: %v", err)
+	}
+	expected := []chunk{
+		{out: []byte("a\n"), offset: 0, next: 15, framed: true, time: now, stream: tjob.Stdout},
+		{out: []byte("bc\n"), offset: 15, next: 31, framed: true, time: now.Add(time.Second), stream: tjob.Stderr},
+	}
+	if len(chunks) != len(expected) {
+		t.Fatalf("expected chunks(%d) == %d", len(chunks), len(expected))
+	}
+	for i, c := range chunks {
+		e := expected[i]
+		if string(c.out) != string(e.out) || c.offset != e.offset || c.next != e.next || !c.framed ||
+			!c.time.Equal(e.time) || c.stream != e.stream {
+			t.Errorf("expected chunk(%+v) == %+v", c, e)
+		}
+	}
+}
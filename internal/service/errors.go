@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+
+	"github.com/neildo/tjob"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// domain of the reasons in the details of errors
+const errorDomain = "tjob"
+
+// failures map errors to their gRPC code in order of precedence
+var failures = []struct { //nolint:gochecknoglobals
+	err  error
+	code codes.Code
+}{
+	{ErrNoPeer, codes.Unauthenticated},
+	{ErrNoTLSInfo, codes.Unauthenticated},
+	{ErrNoPeerCertificates, codes.Unauthenticated},
+	{ErrUnauthorized, codes.PermissionDenied},
+	{ErrNotFound, codes.NotFound},
+	{ErrInvalidArgument, codes.InvalidArgument},
+	{tjob.ErrInvalidArgs, codes.InvalidArgument},
+	{tjob.ErrInvalidRestart, codes.InvalidArgument},
+	{tjob.ErrInvalidHealthCheck, codes.InvalidArgument},
+	{tjob.ErrInvalidLogPolicy, codes.InvalidArgument},
+	{tjob.ErrExecNotFound, codes.InvalidArgument},
+	{tjob.ErrExecDenied, codes.PermissionDenied},
+	{tjob.ErrAlreadyStarted, codes.FailedPrecondition},
+	{tjob.ErrNotStarted, codes.FailedPrecondition},
+	{tjob.ErrNotStartable, codes.FailedPrecondition},
+	{tjob.ErrNotRunning, codes.FailedPrecondition},
+	{tjob.ErrStillRunning, codes.FailedPrecondition},
+	{tjob.ErrNotFramed, codes.FailedPrecondition},
+	{tjob.ErrRemoved, codes.NotFound},
+	{syscall.EAGAIN, codes.ResourceExhausted},
+	{syscall.ENOMEM, codes.ResourceExhausted},
+	{syscall.ENOSPC, codes.ResourceExhausted},
+	{syscall.EDQUOT, codes.ResourceExhausted},
+	{syscall.EMFILE, codes.ResourceExhausted},
+	{syscall.ENFILE, codes.ResourceExhausted},
+	{context.DeadlineExceeded, codes.DeadlineExceeded},
+	{context.Canceled, codes.Canceled},
+}
+
+// UnaryErrors converts the errors of unary RPCs into gRPC status errors
+func UnaryErrors(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	return resp, errorOf(err)
+}
+
+// StreamErrors converts the errors of streaming RPCs into gRPC status errors
+func StreamErrors(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return errorOf(handler(srv, stream))
+}
+
+// errorOf returns the gRPC status error of err with the reason in its details
+// or err as is if already a status error
+func errorOf(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code, reason := codes.Internal, "INTERNAL"
+	for _, f := range failures {
+		if errors.Is(err, f.err) {
+			code, reason = f.code, reasonOf(f.err)
+			break
+		}
+	}
+	st := status.New(code, err.Error())
+	if details, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain}); err == nil {
+		st = details
+	}
+	return st.Err()
+}
+
+// reasonOf returns the error message in UPPER_SNAKE_CASE
+func reasonOf(err error) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_").Replace(err.Error()))
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/neildo/tjob"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorOf(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err    error
+		code   codes.Code
+		reason string
+	}{
+		{fmt.Errorf("job abc: %w", ErrNotFound), codes.NotFound, "NOT_FOUND"},
+		{fmt.Errorf("unauthorized: %w", ErrNoPeerCertificates), codes.Unauthenticated, "NO_PEER_CERTIFICATES"},
+		{fmt.Errorf("health check: %w", tjob.ErrInvalidHealthCheck), codes.InvalidArgument, "INVALID_HEALTH_CHECK"},
+		{fmt.Errorf("start: %w", tjob.ErrExecDenied), codes.PermissionDenied, "EXEC_PERMISSION_DENIED"},
+		{fmt.Errorf("logs: %w", tjob.ErrRemoved), codes.NotFound, "REMOVED"},
+		{fmt.Errorf("mkdir: %w", syscall.ENOSPC), codes.ResourceExhausted, "NO_SPACE_LEFT_ON_DEVICE"},
+		{fmt.Errorf("wait: %w", context.DeadlineExceeded), codes.DeadlineExceeded, "CONTEXT_DEADLINE_EXCEEDED"},
+		{errors.New("boom"), codes.Internal, "INTERNAL"},
+		// first in order of precedence
+		{errors.Join(tjob.ErrNotRunning, ErrInvalidArgument), codes.InvalidArgument, "INVALID_ARGUMENT"},
+		// as is if already a status error
+		{status.Error(codes.Aborted, "aborted"), codes.Aborted, ""},
+	}
+	for _, test := range tests {
+		st, ok := status.FromError(errorOf(test.err))
+		if !ok {
+			t.Errorf("%v: expected status error", test.err)
+			continue
+		}
+		if st.Code() != test.code {
+			t.Errorf("%v: expected code(%v) == %v", test.err, st.Code(), test.code)
+		}
+		reason := ""
+		for _, detail := range st.Details() {
+			if info, ok := detail.(*errdetails.ErrorInfo); ok {
+				reason = info.GetReason()
+			}
+		}
+		if reason != test.reason {
+			t.Errorf("%v: expected reason(%s) == %s", test.err, reason, test.reason)
+		}
+	}
+	if err := errorOf(nil); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func TestErrorInterceptors(t *testing.T) {
+	t.Parallel()
+
+	unary := func(context.Context, any) (any, error) {
+		return "resp", fmt.Errorf("job abc: %w", ErrNotFound)
+	}
+	resp, err := UnaryErrors(context.TODO(), "req", &grpc.UnaryServerInfo{}, unary)
+	if resp != "resp" || status.Code(err) != codes.NotFound {
+		t.Errorf("expected resp(%v) and code(%v) == %v", resp, status.Code(err), codes.NotFound)
+	}
+	if _, err := UnaryErrors(context.TODO(), "req", &grpc.UnaryServerInfo{}, func(context.Context, any) (any, error) {
+		return "resp", nil
+	}); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	stream := func(any, grpc.ServerStream) error {
+		return fmt.Errorf("logs: %w", tjob.ErrNotFramed)
+	}
+	if err := StreamErrors(nil, nil, &grpc.StreamServerInfo{}, stream); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected code(%v) == %v", status.Code(err), codes.FailedPrecondition)
+	}
+}
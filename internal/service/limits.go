@@ -0,0 +1,72 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/neildo/tjob/internal/proto"
+)
+
+// Limits of the resources of a job where zero is unset
+type Limits struct {
+	CPUPercent int `json:"cpu_percent"`
+	MemoryMB   int `json:"memory_mb"`
+	ReadBPS    int `json:"read_bps"`
+	WriteBPS   int `json:"write_bps"`
+}
+
+// ReadUserLimits reads the JSON object of Limits by user from path
+func ReadUserLimits(path string) (map[string]Limits, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("user limits: %w", err)
+	}
+	var limits map[string]Limits
+	if err := json.Unmarshal(b, &limits); err != nil {
+		return nil, fmt.Errorf("user limits %s: %w", path, err)
+	}
+	return limits, nil
+}
+
+// limitsOf returns the requested limits or the defaults within the maxima of
+// the user, or ErrInvalidArgument if out of range
+func (s *JobServer) limitsOf(user string, req *proto.Limits) (Limits, error) {
+	maxima := s.MaxLimits
+	if l, ok := s.UserLimits[user]; ok {
+		maxima = l
+	}
+	var (
+		out Limits
+		err error
+	)
+	if out.CPUPercent, err = limited("cpu", int(req.GetCpuPercent()), s.CPUPercent, maxima.CPUPercent); err != nil {
+		return out, err
+	}
+	if out.MemoryMB, err = limited("mem", int(req.GetMemoryMb()), s.MemoryMB, maxima.MemoryMB); err != nil {
+		return out, err
+	}
+	if out.ReadBPS, err = limited("rbps", int(req.GetReadBps()), s.ReadBPS, maxima.ReadBPS); err != nil {
+		return out, err
+	}
+	if out.WriteBPS, err = limited("wbps", int(req.GetWriteBps()), s.WriteBPS, maxima.WriteBPS); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// limited returns the requested limit or the default unless zero, capped by the
+// maximum unless zero
+func limited(name string, requested, def, maximum int) (int, error) {
+	switch {
+	case requested < 0:
+		return 0, fmt.Errorf("%w: %s %d negative", ErrInvalidArgument, name, requested)
+	case maximum > 0 && requested > maximum:
+		return 0, fmt.Errorf("%w: %s %d above max %d", ErrInvalidArgument, name, requested, maximum)
+	case requested > 0:
+		return requested, nil
+	case maximum > 0 && (def <= 0 || def > maximum):
+		return maximum, nil
+	}
+	return def, nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/neildo/tjob/internal/proto"
+)
+
+func TestLimited(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name                    string
+		requested, def, maximum int
+		out                     int
+		err                     error
+	}{
+		{"default", 0, 50, 0, 50, nil},
+		{"requested", 20, 50, 0, 20, nil},
+		{"unset", 0, 0, 0, 0, nil},
+		{"within max", 80, 50, 100, 80, nil},
+		{"at max", 100, 50, 100, 100, nil},
+		{"above max", 101, 50, 100, 0, ErrInvalidArgument},
+		{"negative", -1, 50, 100, 0, ErrInvalidArgument},
+		{"default above max", 0, 200, 100, 100, nil},
+		{"default unset with max", 0, 0, 100, 100, nil},
+	}
+	for _, test := range tests {
+		out, err := limited("cpu", test.requested, test.def, test.maximum)
+		if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+			t.Errorf("%s: expected err(%v) == %v", test.name, err, test.err)
+			continue
+		}
+		if out != test.out {
+			t.Errorf("%s: expected out(%d) == %d", test.name, out, test.out)
+		}
+	}
+}
+
+func TestLimitsOf(t *testing.T) {
+	t.Parallel()
+
+	s := &JobServer{
+		CPUPercent: 50,
+		MemoryMB:   512,
+		MaxLimits:  Limits{CPUPercent: 100, MemoryMB: 1024, ReadBPS: 10 << 20},
+		UserLimits: map[string]Limits{"bob": {CPUPercent: 400}},
+	}
+	tests := []struct {
+		user string
+		req  *proto.Limits
+		out  Limits
+		err  error
+	}{
+		{"alice", nil, Limits{CPUPercent: 50, MemoryMB: 512, ReadBPS: 10 << 20}, nil},
+		{"alice", &proto.Limits{CpuPercent: 100, WriteBps: 1 << 20}, Limits{CPUPercent: 100, MemoryMB: 512, ReadBPS: 10 << 20, WriteBPS: 1 << 20}, nil},
+		{"alice", &proto.Limits{CpuPercent: 200}, Limits{}, ErrInvalidArgument},
+		{"alice", &proto.Limits{MemoryMb: 2048}, Limits{}, ErrInvalidArgument},
+		{"alice", &proto.Limits{ReadBps: 1 << 30}, Limits{}, ErrInvalidArgument},
+		{"alice", &proto.Limits{WriteBps: -1}, Limits{}, ErrInvalidArgument},
+		// user limits replace the max limits
+		{"bob", &proto.Limits{CpuPercent: 200, MemoryMb: 2048}, Limits{CPUPercent: 200, MemoryMB: 2048}, nil},
+		{"bob", &proto.Limits{CpuPercent: 401}, Limits{}, ErrInvalidArgument},
+	}
+	for _, test := range tests {
+		out, err := s.limitsOf(test.user, test.req)
+		if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+			t.Errorf("%s %v: expected err(%v) == %v", test.user, test.req, err, test.err)
+			continue
+		}
+		if err == nil && out != test.out {
+			t.Errorf("%s %v: expected out(%+v) == %+v", test.user, test.req, out, test.out)
+		}
+	}
+}
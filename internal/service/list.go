@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/neildo/tjob"
+	"github.com/neildo/tjob/internal/proto"
+)
+
+const (
+	// jobs per page unless requested
+	listPageSize = 50
+	// max jobs per page
+	listMaxPageSize = 1000
+)
+
+// states of jobs to list
+const (
+	stateRunning = "running" // including paused
+	statePaused  = "paused"
+	stateStopped = "stopped"
+)
+
+type (
+	// cursor orders jobs by start time and then by id
+	cursor struct {
+		startedAt time.Time
+		id        string
+	}
+
+	// listed job with its status at the time of listing
+	listed struct {
+		cursor
+		job    *userJob
+		status tjob.Status
+	}
+)
+
+// List returns a page of the jobs of the originating user matching all filters
+func (s *JobServer) List(c context.Context, req *proto.ListRequest) (*proto.ListResponse, error) {
+	user, err := s.userOf(c)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized: %w", err)
+	}
+	switch req.GetState() {
+	case "", stateRunning, statePaused, stateStopped:
+	default:
+		return nil, fmt.Errorf("%w: state %s", ErrInvalidArgument, req.GetState())
+	}
+	after, err := cursorOf(req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []listed
+	s.jobs.Range(func(k, v any) bool {
+		id, _ := k.(string)
+		j, ok := v.(*userJob)
+		if !ok || j.user != user {
+			return true
+		}
+		status := j.job.Status()
+		// strip the monotonic clock to compare with cursors
+		l := listed{cursor: cursor{startedAt: status.StartedAt.Round(0), id: id}, job: j, status: status}
+		if l.matches(req) {
+			jobs = append(jobs, l)
+		}
+		return true
+	})
+
+	dir := 1
+	if req.GetOrder() == proto.ListRequest_NEWEST_FIRST {
+		dir = -1
+	}
+	slices.SortFunc(jobs, func(a, b listed) int {
+		return dir * a.compare(b.cursor)
+	})
+	// skip up to the last job of the previous page
+	if after != nil {
+		i := slices.IndexFunc(jobs, func(l listed) bool {
+			return dir*l.compare(*after) > 0
+		})
+		if i < 0 {
+			i = len(jobs)
+		}
+		jobs = jobs[i:]
+	}
+
+	size := int(req.GetPageSize())
+	if size <= 0 {
+		size = listPageSize
+	}
+	size = min(size, listMaxPageSize)
+
+	resp := &proto.ListResponse{}
+	if len(jobs) > size {
+		jobs = jobs[:size]
+		resp.NextPageToken = jobs[size-1].token()
+	}
+	for _, l := range jobs {
+		resp.Jobs = append(resp.Jobs, statusAt(l.id, l.job, l.status))
+	}
+	return resp, nil
+}
+
+// matches returns true if the job matches all filters of the request
+func (l *listed) matches(req *proto.ListRequest) bool {
+	switch req.GetState() {
+	case stateRunning:
+		if !l.status.Started() || l.status.Stopped() {
+			return false
+		}
+	case statePaused:
+		if !l.status.Paused {
+			return false
+		}
+	case stateStopped:
+		if !l.status.Stopped() {
+			return false
+		}
+	}
+	for k, v := range req.GetLabels() {
+		if l.job.labels[k] != v {
+			return false
+		}
+	}
+	if req.GetStartedAfter() != nil && !l.startedAt.After(req.GetStartedAfter().AsTime()) {
+		return false
+	}
+	return strings.Contains(l.status.Cmd, req.GetCmd())
+}
+
+// compare returns -1, 0 or +1 if c is before, same as or after other
+func (c cursor) compare(other cursor) int {
+	if n := c.startedAt.Compare(other.startedAt); n != 0 {
+		return n
+	}
+	return strings.Compare(c.id, other.id)
+}
+
+// token returns the opaque page token of the cursor
+func (c cursor) token() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.startedAt.Format(time.RFC3339Nano) + " " + c.id))
+}
+
+// cursorOf returns the cursor of the page token or nil if empty
+func cursorOf(token string) (*cursor, error) {
+	if token == "" {
+		return nil, nil //nolint:nilnil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: page token", ErrInvalidArgument)
+	}
+	at, id, ok := strings.Cut(string(b), " ")
+	startedAt, err := time.Parse(time.RFC3339Nano, at)
+	if !ok || err != nil {
+		return nil, fmt.Errorf("%w: page token", ErrInvalidArgument)
+	}
+	return &cursor{startedAt: startedAt, id: id}, nil
+}
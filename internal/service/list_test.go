@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob/internal/proto"
+)
+
+func TestListPages(t *testing.T) {
+	t.Parallel()
+
+	s := &JobServer{}
+	now := time.Now()
+	// started in order with ids b and c at the same time
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		at := []time.Duration{0, 1, 1, 2, 3}[i]
+		restore(t, s, "alice", id, now.Add(at*time.Second))
+	}
+	restore(t, s, "bob", "f", now)
+
+	tests := []struct {
+		order proto.ListRequest_Order
+		pages [][]string
+	}{
+		{proto.ListRequest_OLDEST_FIRST, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+		{proto.ListRequest_NEWEST_FIRST, [][]string{{"e", "d"}, {"c", "b"}, {"a"}}},
+	}
+	for _, test := range tests {
+		req := &proto.ListRequest{PageSize: 2, Order: test.order}
+		for i, page := range test.pages {
+			resp, err := s.List(contextOf("alice"), req)
+			if err != nil {
+				t.Fatalf("%v: unexpected list: %v", test.order, err)
+			}
+			var ids []string
+			for _, job := range resp.GetJobs() {
+				ids = append(ids, job.GetJobId())
+			}
+			if !slices.Equal(ids, page) {
+				t.Errorf("%v: expected page %d(%v) == %v", test.order, i, ids, page)
+			}
+			// no token after the last page
+			if last := i == len(test.pages)-1; last != (resp.GetNextPageToken() == "") {
+				t.Errorf("%v: unexpected token %q of page %d", test.order, resp.GetNextPageToken(), i)
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+	}
+
+	if _, err := s.List(contextOf("alice"), &proto.ListRequest{PageToken: "%"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("expected err(%v) == %v", err, ErrInvalidArgument)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+)
+
+// time between collections of stopped jobs
+const collectInterval = time.Minute
+
+type (
+	// Retention of stopped jobs before the collector removes them, oldest
+	// first, where zero is unlimited
+	Retention struct {
+		// MaxAge since stopped
+		MaxAge time.Duration
+
+		// MaxJobs stopped per user
+		MaxJobs int
+
+		// MaxLogBytes of all jobs, including the logs of running jobs which
+		// are never removed but leave less room for those of stopped ones
+		MaxLogBytes int64
+	}
+
+	// stopped job as candidate for removal
+	stopped struct {
+		id        string
+		job       *userJob
+		stoppedAt time.Time
+		logBytes  int64
+	}
+)
+
+// Collect removes stopped jobs beyond the Retention every interval until ctx is done
+func (s *JobServer) Collect(ctx context.Context) {
+	ticker := time.NewTicker(collectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.collect(now)
+		}
+	}
+}
+
+// collect removes the stopped jobs beyond the Retention at now and logs each one
+func (s *JobServer) collect(now time.Time) {
+	var (
+		jobs     []stopped
+		logBytes int64
+	)
+	s.jobs.Range(func(k, v any) bool {
+		id, _ := k.(string)
+		j, ok := v.(*userJob)
+		if !ok {
+			return true
+		}
+		size := j.job.LogSize()
+		logBytes += size
+		if j.job.Done() {
+			jobs = append(jobs, stopped{id: id, job: j, stoppedAt: j.job.Status().StoppedAt, logBytes: size})
+		}
+		return true
+	})
+	// oldest first
+	slices.SortFunc(jobs, func(a, b stopped) int {
+		return a.stoppedAt.Compare(b.stoppedAt)
+	})
+
+	r := s.Retention
+	perUser := make(map[string]int)
+	for _, j := range jobs {
+		perUser[j.job.user]++
+	}
+	for _, j := range jobs {
+		var reason string
+		switch {
+		case r.MaxAge > 0 && now.Sub(j.stoppedAt) > r.MaxAge:
+			reason = "max age"
+		case r.MaxJobs > 0 && perUser[j.job.user] > r.MaxJobs:
+			reason = "max jobs"
+		case r.MaxLogBytes > 0 && logBytes > r.MaxLogBytes:
+			reason = "max log bytes"
+		default:
+			continue
+		}
+		if err := s.remove(j.id, j.job.job, false); err != nil {
+			log.Printf("collect job %s of %s: %v", j.id, j.job.user, err)
+			continue
+		}
+		perUser[j.job.user]--
+		logBytes -= j.logBytes
+		log.Printf("collected job %s of %s with %d log bytes beyond %s", j.id, j.job.user, j.logBytes, reason)
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	tests := []struct {
+		name      string
+		retention Retention
+		kept      []string
+	}{
+		{"unlimited", Retention{}, []string{"a", "b", "c", "d"}},
+		// stopped 150.5s and 149.5s ago for a and b
+		{"max age", Retention{MaxAge: 150 * time.Second}, []string{"b", "c", "d"}},
+		// oldest of alice beyond her last two
+		{"max jobs", Retention{MaxJobs: 2}, []string{"b", "c", "d"}},
+		// oldest until 200 of 400 bytes
+		{"max log bytes", Retention{MaxLogBytes: 250}, []string{"c", "d"}},
+		{"all", Retention{MaxAge: time.Second, MaxJobs: 1, MaxLogBytes: 1}, nil},
+	}
+	for _, test := range tests {
+		s := &JobServer{Retention: test.retention}
+		for i, user := range []string{"alice", "alice", "bob", "alice"} {
+			id := string(rune('a' + i))
+			j := restore(t, s, user, id, start.Add(time.Duration(i)*time.Second))
+			if err := os.WriteFile(j.job.LogPath(), make([]byte, 100), 0o600); err != nil {
+				t.Fatalf("unexpected logs: %v", err)
+			}
+		}
+
+		s.collect(start.Add(151*time.Second + 500*time.Millisecond))
+
+		var kept []string
+		s.jobs.Range(func(k, _ any) bool {
+			id, _ := k.(string)
+			kept = append(kept, id)
+			return true
+		})
+		slices.Sort(kept)
+		if !slices.Equal(kept, test.kept) {
+			t.Errorf("%s: expected kept(%v) == %v", test.name, kept, test.kept)
+		}
+	}
+}
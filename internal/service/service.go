@@ -1,34 +1,52 @@
 package service
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
-	"io"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/neildo/tjob"
+	"github.com/neildo/tjob/internal/journal"
 	"github.com/neildo/tjob/internal/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/peer"
+	protobuf "google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+const (
+	// most bytes of a run request, bounding the record of its job in the journal
+	maxRunSize = 256 << 10
+
+	// time an auto removed job stays after stopping for clients waiting for
+	// it to get its final status
+	autoRemoveDelay = 10 * time.Second
+)
+
 var (
 	ErrNotFound           = errors.New("not found")
 	ErrUnauthorized       = errors.New("unauthorized")
 	ErrUnexpected         = errors.New("unexpected")
+	ErrInvalidArgument    = errors.New("invalid argument")
+	ErrLost               = errors.New("lost on restart")
+	ErrLogsPiped          = errors.New("capped or framed logs piped through the earlier run")
 	ErrNoPeer             = errors.New("no peer")
 	ErrNoTLSInfo          = errors.New("no TLS info")
 	ErrNoPeerCertificates = errors.New("no peer certificates")
 )
 
 type userJob struct {
-	user string
-	job  *tjob.Job
+	user   string
+	job    *tjob.Job
+	labels map[string]string
 }
 
 // JobServer is an implementation of the proto.JobServer interface.
@@ -38,19 +56,69 @@ type JobServer struct {
 	// $MAJ:$MIN device number for MNT namespace
 	Mnt string
 
-	// CPUPercent represents the quota of all cores.
+	// InitPath of the tjob-init helper, or empty to re-execute tjobs itself
+	InitPath string
+
+	// CPUPercent represents the default quota of all cores.
 	CPUPercent int
 
-	// MemoryMB represents the quota of memory to in Megabytes.
+	// MemoryMB represents the default quota of memory to in Megabytes.
 	MemoryMB int
 
-	// ReadBPS represents the max bytes read per second by proc
+	// ReadBPS represents the default max bytes read per second by proc
 	ReadBPS int
 
-	// WriteBPS represents the max bytes write per second by proc
+	// WriteBPS represents the default max bytes write per second by proc
 	WriteBPS int
 
+	// MaxLimits caps the limits requested by any user unless zero
+	MaxLimits Limits
+
+	// UserLimits caps the limits requested by the user instead of MaxLimits
+	UserLimits map[string]Limits
+
+	// MaxTimeout caps the run time of jobs unless zero
+	MaxTimeout time.Duration
+
+	// MaxIdleTimeout caps the time jobs write no logs unless zero
+	MaxIdleTimeout time.Duration
+
+	// Retention of stopped jobs removed by Collect
+	Retention Retention
+
+	// LogLimit is the default and max bytes of logs kept per job unless zero
+	LogLimit int64
+
+	// LogPolicy is the default policy of jobs at their log limit
+	LogPolicy string
+
+	// LogFormat of the logs of jobs: raw or framed with the time and stream
+	// of each output
+	LogFormat string
+
+	// LogDir keeps the logs of jobs at <LogDir>/<user>/<job_id>/output.log
+	// unless empty for temporary files
+	LogDir string
+
+	// LogChunk is the most bytes of logs per message of Logs unless zero for
+	// 64 KiB, or a single larger record of framed logs
+	LogChunk int
+
+	// LogLatency coalesces the logs read within it into one message of Logs
+	// unless zero
+	LogLatency time.Duration
+
 	jobs sync.Map
+
+	// journal of jobs unless nil
+	journal *journal.Journal
+
+	// cleaner of orphans unless nil for tjob.CleanOrphans
+	cleaner func(ids, logPaths []string, logDirs ...string) (tjob.Orphans, error)
+
+	// watchers of new jobs by user
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
 }
 
 // Run starts a new job for originating user only
@@ -60,21 +128,74 @@ func (s *JobServer) Run(c context.Context, req *proto.RunRequest) (*proto.RunRes
 		return nil, fmt.Errorf("unauthorized: %w", err)
 	}
 
+	if size := protobuf.Size(req); size > maxRunSize {
+		return nil, fmt.Errorf("%w: run request of %d bytes above %d", ErrInvalidArgument, size, maxRunSize)
+	}
+	restart, err := tjob.ParseRestartPolicy(req.GetRestart())
+	if err != nil {
+		return nil, fmt.Errorf("restart: %w", err)
+	}
+	for k := range req.GetLabels() {
+		if k == "" {
+			return nil, fmt.Errorf("%w: empty label", ErrInvalidArgument)
+		}
+	}
+	limits, err := s.limitsOf(user, req.GetLimits())
+	if err != nil {
+		return nil, fmt.Errorf("limits: %w", err)
+	}
+	health := healthCheckOf(req.GetHealthCheck())
+	if health != nil {
+		if err := health.Validate(); err != nil {
+			return nil, fmt.Errorf("health check: %w", err)
+		}
+	}
 	job := tjob.NewJob(req.GetPath(), req.GetArgs()...)
+	job.Restart = restart
+	job.HealthCheck = health
 
-	// TODO: add to client request
 	job.Mnt = s.Mnt
-	job.CPUPercent = s.CPUPercent
-	job.MemoryMB = s.MemoryMB
-	job.ReadBPS = s.ReadBPS
-	job.WriteBPS = s.WriteBPS
+	job.InitPath = s.InitPath
+	job.CPUPercent = limits.CPUPercent
+	job.MemoryMB = limits.MemoryMB
+	job.ReadBPS = limits.ReadBPS
+	job.WriteBPS = limits.WriteBPS
+	job.Timeout = capped(req.GetTimeout().AsDuration(), s.MaxTimeout)
+	job.IdleTimeout = capped(req.GetIdleTimeout().AsDuration(), s.MaxIdleTimeout)
+	job.LogLimit = capped(req.GetLogLimit(), s.LogLimit)
+	if job.LogPolicy, err = tjob.ParseLogPolicy(cmp.Or(req.GetLogPolicy(), s.LogPolicy)); err != nil {
+		return nil, fmt.Errorf("log policy: %w", err)
+	}
+	job.LogFormat = s.LogFormat
+	if job.LogDir, err = s.logDirOf(user); err != nil {
+		return nil, fmt.Errorf("log dir: %w", err)
+	}
 
-	// TODO: replace with better uuid shortener
+	// the public id, short of a uuid unless taken, also names the cgroup and
+	// the logs of the job
 	id, _, _ := strings.Cut(job.Id, "-")
+	job.Id = id
+	uj := &userJob{user: user, job: job, labels: req.GetLabels()}
+	for {
+		if _, taken := s.jobs.LoadOrStore(id, uj); !taken {
+			break
+		}
+		id, _, _ = strings.Cut(uuid.NewString(), "-")
+		job.Id = id
+	}
 	resp := &proto.RunResponse{JobId: id}
-	s.jobs.Store(id, &userJob{user: user, job: job})
+	s.added(user, id)
 
-	if err := job.Start(context.Background()); err != nil { //nolint:contextcheck
+	err = job.Start(context.Background()) //nolint:contextcheck
+	s.journaled(id, uj)
+	if req.GetAutoRemove() {
+		go func() {
+			_ = job.Wait()
+			time.Sleep(autoRemoveDelay)
+			_ = s.remove(id, job, false)
+		}()
+	}
+	if err != nil {
 		return resp, fmt.Errorf("job start: %w", err)
 	}
 	return resp, nil
@@ -93,15 +214,58 @@ func (s *JobServer) Stop(c context.Context, req *proto.StopRequest) (*proto.Stop
 	return &proto.StopResponse{}, nil
 }
 
+// Remove removes stopped job and its logs, or running job if forced, for originating user only
+func (s *JobServer) Remove(c context.Context, req *proto.RemoveRequest) (*proto.RemoveResponse, error) {
+	j, err := s.jobOf(c, req.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.remove(req.GetJobId(), j.job, req.GetForce()); err != nil {
+		return nil, fmt.Errorf("job remove: %w", err)
+	}
+	return &proto.RemoveResponse{}, nil
+}
+
+// remove removes the job and forgets its id
+func (s *JobServer) remove(id string, job *tjob.Job, force bool) error {
+	if err := job.Remove(force); err != nil {
+		return err
+	}
+	s.jobs.Delete(id)
+	s.append(journal.Record{Op: journal.OpRemove, ID: id})
+	return nil
+}
+
 // Status returns status of job for originating user only
 func (s *JobServer) Status(c context.Context, req *proto.StatusRequest) (*proto.StatusResponse, error) {
 	j, err := s.jobOf(c, req.GetJobId())
 	if err != nil {
 		return nil, err
 	}
-	status := j.job.Status()
+	return &proto.StatusResponse{Job: statusOf(req.GetJobId(), j)}, nil
+}
+
+// Wait blocks until the job stops or the deadline of the call for originating user only
+func (s *JobServer) Wait(c context.Context, req *proto.WaitRequest) (*proto.WaitResponse, error) {
+	j, err := s.jobOf(c, req.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	if err := j.job.WaitContext(c); err != nil && !j.job.Done() {
+		return nil, err
+	}
+	return &proto.WaitResponse{Job: statusOf(req.GetJobId(), j)}, nil
+}
+
+// statusOf converts the current tjob.Status of the job id
+func statusOf(id string, j *userJob) *proto.Status {
+	return statusAt(id, j, j.job.Status())
+}
+
+// statusAt returns the proto.Status of the job from the status taken earlier
+func statusAt(id string, j *userJob, status tjob.Status) *proto.Status {
 	out := proto.Status{
-		JobId:     req.GetJobId(),
+		JobId:     id,
 		Cmd:       status.Cmd,
 		StartedAt: timestamppb.New(status.StartedAt),
 		Ran:       durationpb.New(status.Ran),
@@ -112,7 +276,20 @@ func (s *JobServer) Status(c context.Context, req *proto.StatusRequest) (*proto.
 	if status.Error != nil {
 		out.Error = status.Error.Error()
 	}
-	return &proto.StatusResponse{Job: &out}, nil
+	out.Reason = status.Reason()
+	out.Health = status.Health
+	out.Restarts = int32(status.Restarts)
+	out.Labels = j.labels
+	out.LogPath = j.job.LogPath()
+	out.Truncated = status.Truncated
+	for _, a := range status.Attempts {
+		out.Attempts = append(out.Attempts, &proto.Attempt{
+			StartedAt: timestamppb.New(a.StartedAt),
+			StoppedAt: timestamppb.New(a.StoppedAt),
+			Exit:      a.Exit,
+		})
+	}
+	return &out
 }
 
 // Logs streams logs for running job or history of logs completed job for originating user only
@@ -123,30 +300,65 @@ func (s *JobServer) Logs(req *proto.LogsRequest, stream grpc.ServerStreamingServ
 		return err
 	}
 
-	logs, _ := j.job.Logs(ctx)
-	defer func() { logs.Close() }()
+	if req.GetTailLines() < 0 || req.GetOffsetBytes() < 0 {
+		return fmt.Errorf("%w: negative tail or offset", ErrInvalidArgument)
+	}
+	opts := tjob.LogOptions{
+		Follow: !req.GetNoFollow(),
+		Offset: req.GetOffsetBytes(),
+		Tail:   int(req.GetTailLines()),
+	}
+	if req.GetSince() != nil {
+		opts.Since = req.GetSince().AsTime()
+	}
+	return s.sendLogs(ctx, j.job, opts, stream)
+}
 
-	buffer := make([]byte, 1024)
-	// poll logs to send back
-	for {
-		n, err := logs.Read(buffer)
-		if n > 0 {
-			out := &proto.LogsResponse{
-				Out: make([]byte, n),
-			}
-			copy(out.Out, buffer[:n])
-			if err = stream.Send(out); err != nil {
-				return fmt.Errorf("stream send: %w", err)
-			}
-		}
-		if err != nil {
-			if !errors.Is(err, io.EOF) {
-				return fmt.Errorf("log read: %w", err)
-			}
-			break
-		}
+// streams by tjob.LogRecord.Stream
+var streams = map[int]string{tjob.Stdout: "stdout", tjob.Stderr: "stderr"} //nolint:gochecknoglobals
+
+// healthCheckOf returns the tjob.HealthCheck of the request or nil if none
+func healthCheckOf(req *proto.HealthCheck) *tjob.HealthCheck {
+	if req == nil {
+		return nil
 	}
-	return nil
+	return &tjob.HealthCheck{
+		Cmd:         req.GetCmd(),
+		Port:        int(req.GetPort()),
+		HTTPPath:    req.GetHttpPath(),
+		Interval:    atLeast(req.GetInterval().AsDuration(), tjob.MinHealthPeriod),
+		Timeout:     atLeast(req.GetTimeout().AsDuration(), tjob.MinHealthPeriod),
+		Retries:     int(req.GetRetries()),
+		OnUnhealthy: req.GetOnUnhealthy(),
+	}
+}
+
+// atLeast returns the requested duration raised to least unless zero for the
+// default or negative
+func atLeast(requested, least time.Duration) time.Duration {
+	if requested <= 0 {
+		return requested
+	}
+	return max(requested, least)
+}
+
+// capped returns the requested duration or size within limit unless limit is zero
+func capped[T ~int64](requested, limit T) T {
+	if limit > 0 && (requested <= 0 || requested > limit) {
+		return limit
+	}
+	return requested
+}
+
+// logDirOf returns the directory of the logs of the user unless no LogDir
+func (s *JobServer) logDirOf(user string) (string, error) {
+	if s.LogDir == "" {
+		return "", nil
+	}
+	if !filepath.IsLocal(user) || filepath.Base(user) != user {
+		return "", fmt.Errorf("%w: user %q", ErrInvalidArgument, user)
+	}
+	return filepath.Join(s.LogDir, user), nil
 }
 
 func (s *JobServer) userOf(c context.Context) (string, error) {
@@ -172,14 +384,15 @@ func (s *JobServer) jobOf(c context.Context, id string) (*userJob, error) {
 	}
 	v, ok := s.jobs.Load(id)
 	if !ok {
-		return nil, ErrUnexpected
+		return nil, fmt.Errorf("job %s: %w", id, ErrNotFound)
 	}
 	job, ok := v.(*userJob)
 	if !ok {
 		return nil, ErrUnexpected
 	}
+	// same as unknown not to tell the ids of other users
 	if job.user != user {
-		return nil, ErrUnauthorized
+		return nil, fmt.Errorf("job %s: %w", id, ErrNotFound)
 	}
 	return job, nil
 }
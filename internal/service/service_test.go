@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob"
+	"github.com/neildo/tjob/internal/proto"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// contextOf returns the context of a request from the user over TLS
+func contextOf(user string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: user}}
+	info := credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}}
+	return peer.NewContext(context.TODO(), &peer.Peer{AuthInfo: info})
+}
+
+// restore adds the stopped job of the user with the id started at
+func restore(t *testing.T, s *JobServer, user, id string, startedAt time.Time) *userJob {
+	t.Helper()
+
+	status := tjob.Status{Cmd: "echo " + id, StartedAt: startedAt, StoppedAt: startedAt.Add(time.Second)}
+	j := &userJob{user: user, job: tjob.RestoreJob(id, status, filepath.Join(t.TempDir(), "output.log"))}
+	s.jobs.Store(id, j)
+	return j
+}
+
+func TestJobOf(t *testing.T) {
+	t.Parallel()
+
+	s := &JobServer{}
+	restore(t, s, "alice", "abc", time.Now())
+
+	if _, err := s.jobOf(contextOf("alice"), "abc"); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	// other users cannot tell the jobs of others from unknown ones
+	for _, test := range []struct{ user, id string }{{"bob", "abc"}, {"alice", "xyz"}} {
+		_, err := s.jobOf(contextOf(test.user), test.id)
+		if !errors.Is(err, ErrNotFound) || err.Error() != "job "+test.id+": not found" {
+			t.Errorf("%s %s: expected err(%v) == %v", test.user, test.id, err, ErrNotFound)
+		}
+	}
+	if _, err := s.jobOf(context.TODO(), "abc"); !errors.Is(err, ErrNoPeer) {
+		t.Errorf("expected err(%v) == %v", err, ErrNoPeer)
+	}
+}
+
+func TestRunTooLarge(t *testing.T) {
+	t.Parallel()
+
+	s := &JobServer{}
+	req := &proto.RunRequest{Path: "echo", Args: []string{strings.Repeat("x", maxRunSize)}}
+	if _, err := s.Run(contextOf("alice"), req); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("expected err(%v) == %v", err, ErrInvalidArgument)
+	}
+}
+
+func TestRunJobID(t *testing.T) {
+	t.Parallel()
+
+	s := &JobServer{LogDir: t.TempDir()}
+	resp, _ := s.Run(contextOf("alice"), &proto.RunRequest{Path: "true"})
+	id := resp.GetJobId()
+	j, err := s.jobOf(contextOf("alice"), id)
+	if err != nil {
+		t.Fatalf("unexpected job: %v", err)
+	}
+	// the cgroup and logs of the job are found by the id users have
+	if j.job.Id != id || j.job.LogDir != filepath.Join(s.LogDir, "alice") {
+		t.Errorf("expected job id(%s) == %s in %s", j.job.Id, id, j.job.LogDir)
+	}
+}
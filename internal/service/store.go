@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/neildo/tjob"
+	"github.com/neildo/tjob/internal/journal"
+)
+
+// Restore reloads the jobs journaled in dir by earlier runs, reattaching to
+// those still running, and journals all new jobs there from now on
+func (s *JobServer) Restore(dir string) error {
+	j, records, err := journal.Open(dir)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	s.journal = j
+
+	now := time.Now()
+	for _, r := range records {
+		status := tjob.Status{Cmd: r.Path}
+		if r.Status != nil {
+			status = r.Status.Restore()
+		}
+		uj := &userJob{user: r.User, labels: r.Labels}
+		switch {
+		case status.Stopped():
+			uj.job = tjob.RestoreJob(r.ID, status, r.LogPath)
+		case r.JobID != "" && status.Pid > 0 && !piped(r):
+			uj.job = tjob.ReattachJob(r.JobID, status, r.LogPath)
+			s.track(r.ID, uj)
+		default:
+			// lost track of the job running before, or of the reader of its
+			// logs, so that Clean kills it instead of leaving it to die of
+			// SIGPIPE once writing any
+			lost := ErrLost
+			if status.Pid > 0 && piped(r) {
+				lost = fmt.Errorf("%w: %w", ErrLost, ErrLogsPiped)
+			}
+			status.StoppedAt = now
+			status.Ran = now.Sub(status.StartedAt)
+			status.Exit = -1
+			status.Error = errors.Join(status.Error, lost)
+			uj.job = tjob.RestoreJob(r.ID, status, r.LogPath)
+			s.append(journal.Record{Op: journal.OpStatus, ID: r.ID, Status: journal.StatusOf(status)})
+		}
+		uj.job.LogFormat = r.LogFormat
+		s.jobs.Store(r.ID, uj)
+	}
+	return nil
+}
+
+// piped returns true if the logs of the job went through a pipe read by the run
+// journaling it, i.e. capped or framed
+func piped(r journal.Record) bool {
+	return r.LogLimit > 0 || r.LogFormat == tjob.LogFramed
+}
+
+// Clean kills and removes the cgroups left by jobs no longer running and
+// removes their logs unless referenced by the jobs restored. Without a journal
+// restored, it cannot tell orphans from the jobs of other tjobs, so it leaves
+// all alone, and only removes logs under LogDir once the journal was replayed.
+func (s *JobServer) Clean() (tjob.Orphans, error) {
+	if s.journal == nil {
+		return tjob.Orphans{}, nil
+	}
+	var ids, logPaths []string
+	s.jobs.Range(func(_, v any) bool {
+		j, ok := v.(*userJob)
+		if !ok {
+			return true
+		}
+		if !j.job.Done() {
+			ids = append(ids, j.job.Id)
+		}
+		logPaths = append(logPaths, j.job.LogPath())
+		return true
+	})
+	// logs of each user under LogDir unless the journal is new and so cannot
+	// tell the jobs of earlier runs
+	var logDirs []string
+	if s.LogDir != "" && s.journal.Replayed() {
+		dirs, err := filepath.Glob(filepath.Join(s.LogDir, "*"))
+		if err != nil {
+			return tjob.Orphans{}, fmt.Errorf("clean: %w", err)
+		}
+		logDirs = dirs
+	}
+	clean := tjob.CleanOrphans
+	if s.cleaner != nil {
+		clean = s.cleaner
+	}
+	orphans, err := clean(ids, logPaths, logDirs...)
+	if err != nil {
+		return orphans, fmt.Errorf("clean: %w", err)
+	}
+	return orphans, nil
+}
+
+// journaled records the new job and then each change of its status until removed
+func (s *JobServer) journaled(id string, j *userJob) {
+	if s.journal == nil {
+		return
+	}
+	s.append(journal.Record{
+		Op:        journal.OpRun,
+		ID:        id,
+		JobID:     j.job.Id,
+		User:      j.user,
+		Path:      j.job.Path,
+		Args:      j.job.Args,
+		Labels:    j.labels,
+		LogPath:   j.job.LogPath(),
+		LogFormat: j.job.LogFormat,
+		LogLimit:  j.job.LogLimit,
+		Status:    journal.StatusOf(j.job.Status()),
+	})
+	s.track(id, j)
+}
+
+// track records each change of the status of the job until removed
+func (s *JobServer) track(id string, j *userJob) {
+	go func() {
+		for ev := range j.job.Events(context.Background()) {
+			if ev.Type != tjob.EventRemoved {
+				s.append(journal.Record{Op: journal.OpStatus, ID: id, Status: journal.StatusOf(j.job.Status())})
+			}
+		}
+	}()
+}
+
+// append writes the record to the journal unless none
+func (s *JobServer) append(r journal.Record) {
+	if s.journal == nil {
+		return
+	}
+	if err := s.journal.Append(r); err != nil {
+		log.Printf("job %s: %v", r.ID, err)
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob"
+	"github.com/neildo/tjob/internal/journal"
+)
+
+func TestCleanWithoutJournal(t *testing.T) {
+	t.Parallel()
+
+	// logs of a job of another tjobs sharing the log dir
+	s := &JobServer{LogDir: t.TempDir()}
+	path := filepath.Join(s.LogDir, "alice", "abc", "output.log")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatalf("unexpected dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("Hello"), 0o600); err != nil {
+		t.Fatalf("unexpected logs: %v", err)
+	}
+
+	orphans, err := s.Clean()
+	if err != nil {
+		t.Fatalf("unexpected clean: %v", err)
+	}
+	if len(orphans.Cgroups) > 0 || len(orphans.Logs) > 0 {
+		t.Errorf("unexpected orphans: %+v", orphans)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected logs kept: %v", err)
+	}
+}
+
+func TestCleanLogDir(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		journal  []journal.Record
+		logDirs  []string
+		logPaths []string
+	}{
+		// new journal cannot tell the jobs of earlier runs
+		{"new journal", nil, nil, nil},
+		{
+			"replayed journal",
+			[]journal.Record{{
+				Op:      journal.OpRun,
+				ID:      "abc",
+				User:    "alice",
+				LogPath: "alice/abc/output.log",
+				Status:  &journal.Status{StartedAt: time.Now(), StoppedAt: time.Now()},
+			}},
+			[]string{"alice", "bob"},
+			[]string{"alice/abc/output.log"},
+		},
+	}
+	for _, test := range tests {
+		var logDirs, logPaths []string
+		s := &JobServer{
+			LogDir: t.TempDir(),
+			cleaner: func(_, paths []string, dirs ...string) (tjob.Orphans, error) {
+				logDirs, logPaths = dirs, paths
+				return tjob.Orphans{}, nil
+			},
+		}
+		for _, user := range []string{"alice", "bob"} {
+			if err := os.Mkdir(filepath.Join(s.LogDir, user), 0o700); err != nil {
+				t.Fatalf("unexpected dir: %v", err)
+			}
+		}
+		dir := t.TempDir()
+		if test.journal != nil {
+			j, _, err := journal.Open(dir)
+			if err != nil {
+				t.Fatalf("%s: unexpected journal: %v", test.name, err)
+			}
+			for _, r := range test.journal {
+				r.LogPath = filepath.Join(s.LogDir, r.LogPath)
+				_ = j.Append(r)
+			}
+			j.Close()
+		}
+		if err := s.Restore(dir); err != nil {
+			t.Fatalf("%s: unexpected restore: %v", test.name, err)
+		}
+		if _, err := s.Clean(); err != nil {
+			t.Fatalf("%s: unexpected clean: %v", test.name, err)
+		}
+
+		for i := range logDirs {
+			logDirs[i], _ = filepath.Rel(s.LogDir, logDirs[i])
+		}
+		for i := range logPaths {
+			logPaths[i], _ = filepath.Rel(s.LogDir, logPaths[i])
+		}
+		if !slices.Equal(logDirs, test.logDirs) || !slices.Equal(logPaths, test.logPaths) {
+			t.Errorf("%s: expected dirs(%v) == %v and paths(%v) == %v", test.name, logDirs, test.logDirs, logPaths, test.logPaths)
+		}
+	}
+}
+
+func TestRestorePiped(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		record journal.Record
+		piped  bool
+	}{
+		{"raw", journal.Record{}, false},
+		{"capped", journal.Record{LogLimit: 10}, true},
+		{"framed", journal.Record{LogFormat: tjob.LogFramed}, true},
+	}
+	for _, test := range tests {
+		// job still running when the earlier run stopped
+		r := test.record
+		r.Op, r.ID, r.JobID, r.User = journal.OpRun, "abc", "abc", "alice"
+		r.LogPath = filepath.Join(t.TempDir(), "output.log")
+		r.Status = &journal.Status{Pid: 1 << 22, StartedAt: time.Now()}
+
+		dir := t.TempDir()
+		j, _, err := journal.Open(dir)
+		if err != nil {
+			t.Fatalf("%s: unexpected journal: %v", test.name, err)
+		}
+		_ = j.Append(r)
+		j.Close()
+
+		s := &JobServer{}
+		if err := s.Restore(dir); err != nil {
+			t.Fatalf("%s: unexpected restore: %v", test.name, err)
+		}
+		v, _ := s.jobs.Load("abc")
+		uj, _ := v.(*userJob)
+		if uj == nil || !uj.job.Done() {
+			t.Fatalf("%s: expected job stopped", test.name)
+		}
+		// left running without the reader of its logs instead of reattached
+		if err := uj.job.Status().Error; errors.Is(err, ErrLogsPiped) != test.piped || errors.Is(err, ErrLost) != test.piped {
+			t.Errorf("%s: expected piped(%v) == %v", test.name, err, test.piped)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neildo/tjob/internal/proto"
+	"google.golang.org/grpc"
+)
+
+type (
+	// update of the status of a watched job
+	update struct {
+		id    string
+		job   *userJob
+		event string
+	}
+
+	// watcher of the new jobs of the user, queuing their ids without bound
+	// for slow watchers to never miss any
+	watcher struct {
+		user  string
+		ids   []string
+		ready chan struct{}
+	}
+)
+
+// Watch streams the current status and then each change of the requested jobs
+// or all jobs of the originating user, including new ones
+func (s *JobServer) Watch(req *proto.WatchRequest, stream grpc.ServerStreamingServer[proto.WatchResponse]) error {
+	// stop all subscriptions once returned
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	user, err := s.userOf(ctx)
+	if err != nil {
+		return fmt.Errorf("unauthorized: %w", err)
+	}
+
+	updates := make(chan update)
+	watched := make(map[string]bool)
+	watch := func(id string, j *userJob) {
+		if watched[id] {
+			return
+		}
+		watched[id] = true
+		go func() {
+			// first event gives the current status
+			for ev := range j.job.Events(ctx) {
+				select {
+				case updates <- update{id: id, job: j, event: ev.Type}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	var added *watcher
+	if ids := req.GetJobIds(); len(ids) > 0 {
+		for _, id := range ids {
+			j, err := s.jobOf(ctx, id)
+			if err != nil {
+				return err
+			}
+			watch(id, j)
+		}
+	} else {
+		// subscribe before listing to never miss a new job
+		added = s.subscribe(user)
+		defer s.unsubscribe(added)
+		s.jobs.Range(func(k, v any) bool {
+			id, _ := k.(string)
+			if j, ok := v.(*userJob); ok && j.user == user {
+				watch(id, j)
+			}
+			return true
+		})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-added.wait():
+			for _, id := range s.addedTo(added) {
+				if v, ok := s.jobs.Load(id); ok {
+					if j, ok := v.(*userJob); ok {
+						watch(id, j)
+					}
+				}
+			}
+		case u := <-updates:
+			out := &proto.WatchResponse{Job: statusOf(u.id, u.job), Event: u.event}
+			if err := stream.Send(out); err != nil {
+				return fmt.Errorf("stream send: %w", err)
+			}
+		}
+	}
+}
+
+// subscribe returns the watcher of new jobs of the user until unsubscribed
+func (s *JobServer) subscribe(user string) *watcher {
+	w := &watcher{user: user, ready: make(chan struct{}, 1)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watchers == nil {
+		s.watchers = make(map[*watcher]struct{})
+	}
+	s.watchers[w] = struct{}{}
+	return w
+}
+
+// unsubscribe stops queuing new jobs for the watcher
+func (s *JobServer) unsubscribe(w *watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.watchers, w)
+}
+
+// wait returns the channel signaled once new jobs are queued, or nil if no
+// watcher to never be
+func (w *watcher) wait() <-chan struct{} {
+	if w == nil {
+		return nil
+	}
+	return w.ready
+}
+
+// addedTo returns the ids of the new jobs queued for the watcher so far
+func (s *JobServer) addedTo(w *watcher) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := w.ids
+	w.ids = nil
+	return ids
+}
+
+// added queues the new job id for the watchers of the user
+func (s *JobServer) added(user, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for w := range s.watchers {
+		if w.user != user {
+			continue
+		}
+		w.ids = append(w.ids, id)
+		select {
+		case w.ready <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob"
+	"github.com/neildo/tjob/internal/proto"
+	"google.golang.org/grpc"
+)
+
+// watchStream fakes the stream of a watch of the user, sending each response
+// only once received
+type watchStream struct {
+	grpc.ServerStreamingServer[proto.WatchResponse]
+	ctx  context.Context
+	sent chan *proto.WatchResponse
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(out *proto.WatchResponse) error {
+	select {
+	case s.sent <- out:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// watch starts watching the jobs of the user until the test ends
+func watch(t *testing.T, s *JobServer, user string, ids ...string) (*watchStream, <-chan error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(contextOf(user))
+	t.Cleanup(cancel)
+	stream := &watchStream{ctx: ctx, sent: make(chan *proto.WatchResponse)}
+	done := make(chan error, 1)
+	go func() { done <- s.Watch(&proto.WatchRequest{JobIds: ids}, stream) }()
+	return stream, done
+}
+
+// received returns the job id and event of the next n responses sorted
+func received(t *testing.T, stream *watchStream, n int) []string {
+	t.Helper()
+
+	var out []string
+	for range n {
+		select {
+		case resp := <-stream.sent:
+			out = append(out, resp.GetJob().GetJobId()+" "+resp.GetEvent())
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d responses: %v", n, out)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// quiet fails if the stream sends any response for a while
+func quiet(t *testing.T, stream *watchStream) {
+	t.Helper()
+
+	select {
+	case resp := <-stream.sent:
+		t.Errorf("unexpected response: %v", resp)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	s := &JobServer{}
+	now := time.Now()
+	restore(t, s, "alice", "abc", now)
+	restore(t, s, "alice", "def", now)
+	restore(t, s, "bob", "xyz", now)
+
+	tests := []struct {
+		name string
+		ids  []string
+		out  []string
+	}{
+		{"one job", []string{"abc"}, []string{"abc exited"}},
+		{"several jobs", []string{"abc", "def"}, []string{"abc exited", "def exited"}},
+		{"all jobs of the user", nil, []string{"abc exited", "def exited"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			stream, _ := watch(t, s, "alice", test.ids...)
+			if out := received(t, stream, len(test.out)); !slices.Equal(out, test.out) {
+				t.Errorf("expected out(%v) == %v", out, test.out)
+			}
+			quiet(t, stream)
+		})
+	}
+}
+
+func TestWatchNotFound(t *testing.T) {
+	t.Parallel()
+
+	s := &JobServer{}
+	restore(t, s, "bob", "xyz", time.Now())
+	for _, id := range []string{"xyz", "abc"} {
+		_, done := watch(t, s, "alice", id)
+		if err := <-done; !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected err(%v) == %v", id, err, ErrNotFound)
+		}
+	}
+}
+
+func TestWatchChanges(t *testing.T) {
+	t.Parallel()
+
+	s := &JobServer{}
+	j := restore(t, s, "alice", "abc", time.Now())
+	stream, _ := watch(t, s, "alice", "abc")
+	received(t, stream, 1)
+
+	if err := j.job.Remove(false); err != nil {
+		t.Fatalf("unexpected remove: %v", err)
+	}
+	if out := received(t, stream, 1); out[0] != "abc removed" {
+		t.Errorf("expected out(%v) == abc removed", out)
+	}
+}
+
+func TestWatchAdded(t *testing.T) {
+	t.Parallel()
+
+	s := &JobServer{}
+	restore(t, s, "alice", "abc", time.Now())
+	stream, _ := watch(t, s, "alice")
+	received(t, stream, 1)
+
+	// only new jobs of the user
+	restore(t, s, "alice", "def", time.Now())
+	s.added("alice", "def")
+	restore(t, s, "bob", "xyz", time.Now())
+	s.added("bob", "xyz")
+	if out := received(t, stream, 1); out[0] != "def exited" {
+		t.Errorf("expected out(%v) == def exited", out)
+	}
+	quiet(t, stream)
+}
+
+func TestWatchSlow(t *testing.T) {
+	t.Parallel()
+
+	s := &JobServer{}
+	stream, _ := watch(t, s, "alice")
+
+	// many new jobs while not receiving any
+	const jobs = 100
+	var expected []string
+	for i := range jobs {
+		id := fmt.Sprintf("%03d", i)
+		restore(t, s, "alice", id, time.Now())
+		s.added("alice", id)
+		expected = append(expected, id+" "+tjob.EventExited)
+	}
+	if out := received(t, stream, jobs); !slices.Equal(out, expected) {
+		t.Errorf("expected all %d jobs: %v", jobs, out)
+	}
+}
@@ -0,0 +1,55 @@
+package tjob_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neildo/tjob"
+	"golang.org/x/sys/unix"
+)
+
+// env var of the MAJ:MIN device number of the mnt namespace of jailed jobs
+const mntEnv = "TJOB_TEST_MNT"
+
+// requireJail skips unless jobs can be jailed, i.e. run by root with cgroup v2
+// and the device of TJOB_TEST_MNT, and returns the path of tjob-init built
+func requireJail(t *testing.T) string {
+	t.Helper()
+
+	var fs unix.Statfs_t
+	switch {
+	case os.Geteuid() != 0:
+		t.Skip("requires root")
+	case unix.Statfs(tjob.CgroupRoot, &fs) != nil || fs.Type != unix.CGROUP2_SUPER_MAGIC:
+		t.Skip("requires cgroup v2 at " + tjob.CgroupRoot)
+	case os.Getenv(mntEnv) == "":
+		t.Skip("requires " + mntEnv + " as $MAJ:$MIN of the device written")
+	}
+	return build(t, "./cmd/tjob-init")
+}
+
+// build returns the path of the binary built of the package
+func build(t *testing.T, pkg string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), filepath.Base(pkg))
+	if out, err := exec.Command("go", "build", "-o", path, pkg).CombinedOutput(); err != nil {
+		t.Fatalf("unexpected build: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return path
+}
+
+// jailed returns the job of the command jailed by tjob-init at initPath
+func jailed(t *testing.T, initPath, name string, args ...string) *tjob.Job {
+	t.Helper()
+
+	job := tjob.NewJob(name, args...)
+	job.InitPath = initPath
+	job.Mnt = os.Getenv(mntEnv)
+	job.MemoryMB = 64
+	job.LogDir = t.TempDir()
+	return job
+}
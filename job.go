@@ -7,6 +7,8 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -17,6 +19,19 @@ import (
 
 const (
 	jailOp = ".tjob"
+	// env var marking the process the parent re-executed as the jail, only
+	// consumed by the jail so the command never inherits it
+	jailEnv = "TJOB_JAIL"
+
+	// default grace period between SIGTERM and SIGKILL
+	stopGrace = 10 * time.Second
+	// most often the log size is polled for idle timeout
+	idlePoll = time.Second
+
+	// log file of each job under <LogDir>/<job_id>
+	logName     = "output.log"
+	logDirMode  = 0o700
+	logFileMode = 0o600
 )
 
 // libState
@@ -31,18 +46,31 @@ const (
 	created = iota
 	started
 	stopped
+	removed
 )
 
 var (
-	ErrAlreadyInited        = errors.New("already inited")
-	ErrAlreadyStarted       = errors.New("already started")
-	ErrNotStartable         = errors.New("not startable")
-	ErrNotStarted           = errors.New("not started")
-	ErrAlreadyJailed        = errors.New("already jailed")
-	ErrInvalidArgs          = errors.New("invalid args")
-	ErrForceStop            = errors.New("force stop")
-	ErrReadAgain            = errors.New("read again")
-	libState          int32 = notInited //nolint:gochecknoglobals
+	ErrAlreadyInited          = errors.New("already inited")
+	ErrAlreadyStarted         = errors.New("already started")
+	ErrNotStartable           = errors.New("not startable")
+	ErrNotStarted             = errors.New("not started")
+	ErrAlreadyJailed          = errors.New("already jailed")
+	ErrInvalidArgs            = errors.New("invalid args")
+	ErrForceStop              = errors.New("force stop")
+	ErrReadAgain              = errors.New("read again")
+	ErrExecNotFound           = errors.New("exec not found")
+	ErrExecDenied             = errors.New("exec permission denied")
+	ErrMountFailed            = errors.New("mount failed")
+	ErrJailFailed             = errors.New("jail failed")
+	ErrHandshakeTimeout       = errors.New("handshake timeout")
+	ErrInitMissing            = errors.New("init missing")
+	ErrTimedOut               = errors.New("timed out")
+	ErrIdleTimedOut           = fmt.Errorf("idle %w", ErrTimedOut)
+	ErrNotRunning             = errors.New("not running")
+	ErrStillRunning           = errors.New("still running")
+	ErrRemoved                = errors.New("removed")
+	ErrExitUnknown            = errors.New("exit unknown")
+	libState            int32 = notInited //nolint:gochecknoglobals
 )
 
 type (
@@ -54,6 +82,11 @@ type (
 		Ran       time.Duration
 		Exit      int32 // exit code
 		Error     error // go error
+		Restarts  int
+		Attempts  []Attempt // exit history of the last 16 attempts at most, Restarts counting all
+		Health    string    // starting, healthy, or unhealthy with HealthCheck
+		Paused    bool
+		Truncated bool // output dropped over LogLimit
 	}
 
 	Job struct {
@@ -69,6 +102,10 @@ type (
 		// $MAJ:$MIN device number for MNT namespace
 		Mnt string
 
+		// InitPath runs the tjob-init helper in the jail instead of
+		// re-executing /proc/self/exe, which requires Init() first in main.
+		InitPath string
+
 		// CPUPercent represents the quota of all cores.
 		CPUPercent int
 
@@ -81,15 +118,81 @@ type (
 		// WriteBPS represents the max bytes write per second by proc
 		WriteBPS int
 
+		// Timeout stops the job running longer than it unless zero, counting
+		// all attempts but not the backoffs between them
+		Timeout time.Duration
+
+		// IdleTimeout stops the job writing no logs for longer than it unless
+		// zero, again only while an attempt runs
+		IdleTimeout time.Duration
+
+		// StopGrace waits after SIGTERM before SIGKILL unless zero for the default
+		StopGrace time.Duration
+
+		// Restart policy once the job exits
+		Restart RestartPolicy
+
+		// HealthCheck probes the job for its Health unless nil
+		HealthCheck *HealthCheck
+
+		// LogDir keeps the logs at <LogDir>/<Id>/output.log unless empty for
+		// a temporary file
+		LogDir string
+
+		// LogLimit caps the bytes of logs kept per LogPolicy unless zero. The
+		// output then goes through this process, as with framed LogFormat, so
+		// the job cannot be reattached once it restarts.
+		LogLimit int64
+
+		// LogPolicy once the logs reach LogLimit: truncate (default) the
+		// oldest, stop writing, or kill the job
+		LogPolicy string
+
+		// LogFormat of the logs: raw (default) output, or framed records of
+		// the time, stream and output read by LogRecordReader
+		LogFormat string
+
 		// log file bind to os/exec.Cmd.Stdout and os/exec.Cmd.Stderr
 		logs *os.File
 
+		// bind to os/exec.Cmd.Stderr instead unless nil
+		errs *os.File
+
+		// path of the log file kept once closed
+		logPath string
+
+		// writer of the logs read from the other end of the pipes of logs
+		// unless neither LogLimit nor framed
+		writer *logWriter
+		pipes  []*os.File
+		copied chan struct{}
+
+		// broadcaster of the logs shared by their followers while any
+		hubMu sync.Mutex
+		hub   *LogBroadcaster
+
 		// cgroup file assigned to job
 		cgroup *os.File
 
 		// closed when done running
 		doneCh chan bool
 
+		// closed once stopped to cancel any restart
+		stopCh   chan struct{}
+		stopOnce sync.Once
+
+		// current attempt of the job
+		attempt Attempt
+
+		// run time of the attempts stopped so far, without the backoffs
+		ran time.Duration
+
+		// restarts the current attempt regardless of the Restart policy
+		restartNow bool
+
+		// lifecycle events for subscribers
+		events events
+
 		// started prevents the same process called twice
 		state int32
 
@@ -105,43 +208,83 @@ type (
 		Done() bool
 	}
 	JobReader struct {
+		ctx     context.Context //nolint:containedctx
 		doner   Doner
-		logs    *os.File
+		path    string
+		follow  bool
 		inotify *os.File
+		events  []byte
+
+		// segment of the logs read so far at base in all logs ever written
+		mu   sync.Mutex
+		logs *os.File
+		base int64
+
+		// record to read first when starting in the middle of framed logs
+		pending []byte
+
+		// broadcaster of the logs followed at the offset unless nil, reading
+		// the segments only for any logs before those kept in memory
+		hub    *LogBroadcaster
+		offset int64
+		leave  func()
 	}
 )
 
+// init runs the command in the jail once re-executed as one by the parent,
+// before any code of main, and exits with its exit code or non-zero if the jail
+// fails. main then never runs with the args of the jail, even without Init().
+func init() {
+	_, marked := os.LookupEnv(jailEnv)
+	if !marked || len(os.Args) < 2 || os.Args[1] != jailOp {
+		return
+	}
+	if err := runJail(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+	os.Exit(1)
+}
+
+// Init MUST be called first in main before starting any job unless by the
+// init helper
 func Init() error {
-	// MUST confirm Init() was called before starting any job
 	if !atomic.CompareAndSwapInt32(&libState, notInited, startable) {
 		return ErrAlreadyInited
 	}
+	return nil
+}
 
-	if len(os.Args) == 2 && os.Args[1] == jailOp {
+// runJail runs the command in os.Args as pid 1 of its namespaces and exits with its
+// exit code unless failing first
+func runJail() error {
+	_ = os.Unsetenv(jailEnv)
+	if len(os.Args) == 2 {
 		return ErrInvalidArgs
 	}
-	// skip run command in jail
-	if len(os.Args) < 3 || os.Args[1] != jailOp {
-		return nil
-	}
 	// cannot start another job in the jailed state
-	if !atomic.CompareAndSwapInt32(&libState, startable, jailed) {
-		return ErrAlreadyJailed
-	}
+	atomic.StoreInt32(&libState, jailed)
+
+	// report setup errors back to the parent until the proc runs
+	pipe, exit := syncPipe(), exitFile()
 	if err := mount(); err != nil {
-		return err
+		return report(pipe, opMount, err)
+	}
+	if err := loopback(); err != nil {
+		return report(pipe, opNet, err)
 	}
 
-	// run the arbitrary proc in jail
+	// run the arbitrary proc in jail as pid 1 of its namespace
 	args := os.Args[2:]
 	cmd := exec.Command(args[0], args[1:]...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("init: %w", err)
+	code, sig, err := supervise(cmd, pipe)
+	if err != nil {
+		return report(pipe, opExec, err)
 	}
-	os.Exit(cmd.ProcessState.ExitCode())
+	writeExit(exit, code, sig)
+	os.Exit(code)
 
 	return nil
 }
@@ -156,82 +299,413 @@ func (s Status) Stopped() bool {
 	return !s.StoppedAt.IsZero()
 }
 
+// Reason returns why the job stopped or empty if still running
+func (s Status) Reason() string {
+	switch {
+	case !s.Stopped():
+		return ""
+	case errors.Is(s.Error, ErrTimedOut):
+		return "timed out"
+	case errors.Is(s.Error, ErrForceStop):
+		return "stopped"
+	case errors.Is(s.Error, ErrUnhealthy):
+		return "unhealthy"
+	case errors.Is(s.Error, ErrLogLimit):
+		return "log limit"
+	default:
+		return "exited"
+	}
+}
+
 // Start starts the command
 func (j *Job) Start(ctx context.Context) error {
-	// disallow starting another job unless safe
-	if atomic.LoadInt32(&libState) != startable {
+	// disallow starting another job unless safe. only the init helper
+	// spares the need for Init()
+	state := atomic.LoadInt32(&libState)
+	if state == jailed || (state != startable && j.InitPath == "") {
 		return ErrNotStartable
 	}
+	if j.HealthCheck != nil {
+		if err := j.HealthCheck.Validate(); err != nil {
+			return err
+		}
+	}
+	policy, err := ParseLogPolicy(j.LogPolicy)
+	if err != nil {
+		return err
+	}
+	format, err := ParseLogFormat(j.LogFormat)
+	if err != nil {
+		return err
+	}
 	// prevent same proc starting this job twice
 	if !atomic.CompareAndSwapInt32(&j.state, 0, started) {
 		return ErrAlreadyStarted
 	}
 
-	// jail the arbitrary process with required isolation
-	cmd, err := jail(ctx, j)
+	// write stdout and stderr of all attempts to log file
+	logs, err := j.createLogs()
 	if err != nil {
-		return fmt.Errorf("jail: %w", err)
+		j.finish(err)
+		return fmt.Errorf("log file: %w", err)
+	}
+	logPath := logs.Name()
+	var errs *os.File
+	if j.LogLimit > 0 || format == LogFramed {
+		if logs, errs, err = j.pipeLogs(logs, policy, format == LogFramed); err != nil {
+			j.finish(err)
+			return fmt.Errorf("log pipe: %w", err)
+		}
+	}
+	j.rw.Lock()
+	j.logs, j.errs = logs, errs
+	j.logPath = logPath
+	j.status.StartedAt = time.Now()
+	j.rw.Unlock()
+
+	cmd, err := j.spawn(ctx)
+	if cmd == nil {
+		j.finish(err)
+		return err
 	}
-	// write stdout and stderr to log file
-	logs, err := os.CreateTemp("", "*")
+	// wait on separate coroutine
+	go j.wait(ctx, cmd, err)
+
 	if err != nil {
-		return fmt.Errorf("log file: %w", err)
+		return fmt.Errorf("start: %w", err)
+	}
+	go j.expire()
+	if j.HealthCheck != nil {
+		go j.monitor()
+	}
+
+	return nil
+}
+
+// createLogs creates the log file readable by the owner only in LogDir or as a
+// temporary file
+func (j *Job) createLogs() (*os.File, error) {
+	if j.LogDir == "" {
+		return os.CreateTemp("", orphanPrefix+"*"+logSuffix)
+	}
+	dir := filepath.Join(j.LogDir, j.Id)
+	if err := os.MkdirAll(dir, logDirMode); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filepath.Join(dir, logName), os.O_RDWR|os.O_CREATE|os.O_EXCL, logFileMode)
+}
+
+// pipeLogs returns the pipes for stdout, and stderr unless the same if not
+// framed, of the job copied to the log file up to LogLimit
+func (j *Job) pipeLogs(file *os.File, policy string, framed bool) (*os.File, *os.File, error) {
+	streams := []int{Stdout}
+	if framed {
+		streams = append(streams, Stderr)
+	}
+	var writers []*os.File
+	for range streams {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeFiles(append(writers, j.pipes...))
+			file.Close()
+			return nil, nil, err
+		}
+		j.pipes, writers = append(j.pipes, r), append(writers, w)
+	}
+	j.writer = &logWriter{
+		file:     file,
+		limit:    j.LogLimit,
+		policy:   policy,
+		framed:   framed,
+		exceeded: func() { _ = j.terminate(ErrLogLimit) },
+	}
+
+	var wg sync.WaitGroup
+	for i, stream := range streams {
+		wg.Add(1)
+		go func(r *os.File) {
+			defer wg.Done()
+			defer r.Close()
+
+			// keep reading despite errors writing for the job never to block
+			buffer := make([]byte, logBuffer)
+			for {
+				n, err := r.Read(buffer)
+				if n > 0 {
+					_, _ = j.writer.WriteStream(stream, buffer[:n])
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(j.pipes[i])
+	}
+	j.copied = make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(j.copied)
+	}()
+
+	if !framed {
+		return writers[0], nil, nil
+	}
+	return writers[0], writers[1], nil
+}
+
+// spawn starts the next attempt of the command in a new jail. It returns the
+// command once it runs, or also the error of why the jail could not run it.
+func (j *Job) spawn(ctx context.Context) (*exec.Cmd, error) {
+	// jail the arbitrary process with required isolation
+	cmd, pipe, err := jail(ctx, j)
+	if err != nil {
+		return nil, fmt.Errorf("jail: %w", err)
+	}
+	defer pipe.Close()
+
+	cmd.Stdout = j.logs
+	cmd.Stderr = j.logs
+	if j.errs != nil {
+		cmd.Stderr = j.errs
 	}
-	cmd.Stdout = logs
-	cmd.Stderr = logs
 
 	// start command
+	err = cmd.Start()
+	// close child ends of pipes so reads see EOF once the jail closes them
+	closeFiles(cmd.ExtraFiles)
+	if err != nil {
+		j.release()
+		return nil, fmt.Errorf("start: %w", err)
+	}
 	j.rw.Lock()
-	j.status.StartedAt = time.Now()
-	if err := cmd.Start(); err != nil {
-		logs.Close()
-		j.status.Error = err
-		j.status.StoppedAt = time.Now()
+	j.status.Pid = cmd.Process.Pid
+	j.attempt = Attempt{Pid: cmd.Process.Pid, StartedAt: time.Now()}
+	if j.HealthCheck != nil {
+		j.status.Health = HealthStarting
+	}
+	// stopped after the last check before this attempt started
+	stopping := j.status.Error != nil
+	j.rw.Unlock()
+	if stopping {
+		_ = syscall.Kill(cmd.Process.Pid, syscall.SIGTERM)
+		go j.kill(cmd.Process.Pid, j.grace())
+	}
+
+	// block until the jail runs the command or reports why it cannot
+	err = handshake(pipe)
+	if errors.Is(err, ErrHandshakeTimeout) {
+		_ = cmd.Process.Kill()
+	}
+	if err == nil {
+		j.events.emit(Event{Type: EventStarted, Pid: cmd.Process.Pid})
+	}
+	return cmd, err
+}
+
+// expire stops the job once it runs longer than Timeout or writes no logs for
+// IdleTimeout, neither counting the backoffs between attempts
+func (j *Job) expire() {
+	var (
+		deadline, poll <-chan time.Time
+		timer          *time.Timer
+	)
+	if j.Timeout > 0 {
+		timer = time.NewTimer(j.Timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	if j.IdleTimeout > 0 {
+		ticker := time.NewTicker(min(j.IdleTimeout, idlePoll))
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	if deadline == nil && poll == nil {
+		return
+	}
+
+	size, active := int64(0), time.Now()
+	for {
+		select {
+		case <-j.doneCh:
+			return
+		case <-deadline:
+			if ran, _ := j.running(); ran < j.Timeout {
+				timer.Reset(j.Timeout - ran)
+				continue
+			}
+			_ = j.terminate(ErrTimedOut)
+			return
+		case now := <-poll:
+			// any growth of the logs counts as output, and backing off as active
+			if _, running := j.running(); !running {
+				active = now
+				continue
+			}
+			if written := j.written(); written != size {
+				size, active = written, now
+				continue
+			}
+			if now.Sub(active) >= j.IdleTimeout {
+				_ = j.terminate(ErrIdleTimedOut)
+				return
+			}
+		}
+	}
+}
+
+// running returns the run time of all attempts so far without the backoffs
+// between them, and true unless backing off
+func (j *Job) running() (time.Duration, bool) {
+	j.rw.RLock()
+	defer j.rw.RUnlock()
+
+	if !j.attempt.StoppedAt.IsZero() {
+		return j.ran, false
+	}
+	return j.ran + time.Since(j.attempt.StartedAt), true
+}
+
+// written returns the bytes of output of the job so far
+func (j *Job) written() int64 {
+	if j.writer != nil {
+		return j.writer.Written()
+	}
+	info, err := j.logs.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// wait waits for each attempt to stop and restarts it per the Restart policy
+func (j *Job) wait(ctx context.Context, cmd *exec.Cmd, err error) {
+	for {
+		werr := cmd.Wait()
+		exit := j.exited(exitOf(cmd.ProcessState), signalOf(cmd.ProcessState, j.logPath))
+
+		// never restart jobs failing to jail or stopped on purpose
+		j.rw.Lock()
+		restarts, reason, now := j.status.Restarts, j.status.Error, j.restartNow
+		j.restartNow = false
+		j.rw.Unlock()
+		if err != nil || reason != nil || !(now || j.Restart.Retry(exit, restarts)) {
+			j.finish(errors.Join(err, werr))
+			return
+		}
+
+		// back off until the next attempt unless stopped
+		timer := time.NewTimer(j.Restart.Backoff(restarts))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			j.finish(errors.Join(werr, ctx.Err()))
+			return
+		case <-j.stopCh:
+			timer.Stop()
+			j.finish(werr)
+			return
+		case <-timer.C:
+		}
+
+		// stopped once the backoff fired but before the next attempt
+		j.rw.Lock()
+		if j.status.Error != nil {
+			j.rw.Unlock()
+			j.finish(werr)
+			return
+		}
+		j.status.Restarts++
+		restarts = j.status.Restarts
 		j.rw.Unlock()
+		// separate the logs of each attempt
+		_, _ = fmt.Fprintf(j.logs, "--- tjob: restart %d after exit %d ---\n", restarts, exit)
 
-		return fmt.Errorf("start: %w", err)
+		if cmd, err = j.spawn(ctx); cmd == nil {
+			j.finish(err)
+			return
+		}
 	}
-	j.logs = logs
-	j.status.Pid = cmd.Process.Pid
+}
+
+// exited records the exit history of the last attempt and releases its cgroup
+func (j *Job) exited(exit int32, sig syscall.Signal) int32 {
+	j.rw.Lock()
+	j.attempt.StoppedAt = time.Now()
+	j.attempt.Exit = exit
+	attempt := j.attempt
+	j.ran += attempt.StoppedAt.Sub(attempt.StartedAt)
+	j.status.Exit = attempt.Exit
+	j.status.Attempts = append(j.status.Attempts, attempt)
+	if n := len(j.status.Attempts); n > maxAttempts {
+		j.status.Attempts = slices.Delete(j.status.Attempts, 0, n-maxAttempts)
+	}
+	j.status.Paused = false
+	oom := j.cgroup != nil && oomKilled(j.cgroup)
+	j.release()
 	j.rw.Unlock()
 
-	// wait on separate coroutine
-	go j.wait(cmd)
+	if oom {
+		j.events.emit(Event{Type: EventOOM, Time: attempt.StoppedAt, Pid: attempt.Pid})
+	}
+	if sig != 0 {
+		j.events.emit(Event{Type: EventSignaled, Time: attempt.StoppedAt, Pid: attempt.Pid, Signal: sig})
+	}
+	j.events.emit(Event{Type: EventExited, Time: attempt.StoppedAt, Pid: attempt.Pid, Exit: attempt.Exit})
 
-	return nil
+	return attempt.Exit
+}
+
+// release closes and removes the cgroup of the last attempt
+func (j *Job) release() {
+	if j.cgroup != nil {
+		j.cgroup.Close()
+		_ = unix.Rmdir(j.cgroup.Name())
+		j.cgroup = nil
+	}
 }
 
-// wait waits for the process to stop
-func (j *Job) wait(cmd *exec.Cmd) {
+// finish sets the final status with err of the last attempt
+func (j *Job) finish(err error) {
 	defer close(j.doneCh)
 
-	err := cmd.Wait()
+	// close log file
+	if j.logs != nil {
+		j.logs.Close()
+	}
+	if j.errs != nil {
+		j.errs.Close()
+	}
+	if j.writer != nil {
+		// copy the output left in the pipes unless held open by any orphan
+		select {
+		case <-j.copied:
+		case <-time.After(drainTimeout):
+			for _, pipe := range j.pipes {
+				_ = pipe.SetReadDeadline(time.Now())
+			}
+			<-j.copied
+		}
+		j.writer.Close()
+	}
 	now := time.Now()
 
 	// Set final status
 	j.rw.Lock()
-	defer j.rw.Unlock()
 	j.status.Ran = now.Sub(j.status.StartedAt)
 	j.status.StoppedAt = now
-	if cmd.ProcessState != nil {
-		j.status.Exit = int32(cmd.ProcessState.ExitCode())
-	}
 
-	if err != nil {
-		err = errors.Join(j.status.Error, err)
+	// keep the reason the job was stopped even if it exits cleanly
+	j.status.Error = errors.Join(j.status.Error, err)
+	if j.writer != nil {
+		j.status.Truncated = j.writer.Truncated()
 	}
-	j.status.Error = err
-
-	// close log file
-	j.logs.Close()
+	atomic.StoreInt32(&j.state, stopped)
+	logPath := j.logPath
+	j.rw.Unlock()
 
-	// close cgroup file
-	if j.cgroup != nil {
-		j.cgroup.Close()
-		// remove cgroup dir
-		_ = unix.Rmdir(j.cgroup.Name())
+	// wake readers of the logs waiting for more
+	if logs, err := os.Open(logPath); err == nil {
+		logs.Close()
 	}
-	atomic.CompareAndSwapInt32(&j.state, started, stopped)
 }
 
 // Wait waits for the process to stop
@@ -240,19 +714,128 @@ func (j *Job) Wait() error {
 	return j.status.Error
 }
 
-// Stop signal SIGKILL on the process group and idempotent.
+// WaitContext waits for the process to stop unless ctx is done first
+func (j *Job) WaitContext(ctx context.Context) error {
+	select {
+	case <-j.doneCh:
+		return j.status.Error
+	case <-ctx.Done():
+		return fmt.Errorf("wait: %w", ctx.Err())
+	}
+}
+
+// Stop signal SIGTERM then SIGKILL after StopGrace on the process group and idempotent.
 func (j *Job) Stop() error {
+	return j.terminate(ErrForceStop)
+}
+
+// terminate signals SIGTERM for the first reason given and SIGKILL if still
+// running after the grace period
+func (j *Job) terminate(reason error) error {
 	j.rw.Lock()
 	defer j.rw.Unlock()
 
 	if j.status.Stopped() {
 		return nil
 	}
-	j.status.Error = ErrForceStop
+	if j.status.Error == nil {
+		j.status.Error = reason
+	}
+	j.stopOnce.Do(func() { close(j.stopCh) })
+
+	// thaw for the job to handle SIGTERM
+	if j.status.Paused && j.cgroup != nil && setFrozen(j.cgroup, false) == nil {
+		j.status.Paused = false
+		j.events.emit(Event{Type: EventResumed, Pid: j.attempt.Pid})
+	}
 
-	if err := syscall.Kill(j.status.Pid, syscall.SIGTERM); err != nil {
+	// no attempt to signal while backing off between attempts
+	if !j.attempt.StoppedAt.IsZero() {
+		return nil
+	}
+	if err := syscall.Kill(j.attempt.Pid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
 		return fmt.Errorf("stop: %w", err)
 	}
+	go j.kill(j.attempt.Pid, j.grace())
+
+	return nil
+}
+
+// restart signals SIGTERM then SIGKILL after StopGrace to the running attempt
+// for the next one to start regardless of the Restart policy
+func (j *Job) restart() error {
+	j.rw.Lock()
+	defer j.rw.Unlock()
+
+	if j.status.Stopped() || !j.attempt.StoppedAt.IsZero() {
+		return nil
+	}
+	j.restartNow = true
+
+	if err := syscall.Kill(j.attempt.Pid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("restart: %w", err)
+	}
+	go j.kill(j.attempt.Pid, j.grace())
+
+	return nil
+}
+
+func (j *Job) grace() time.Duration {
+	if j.StopGrace <= 0 {
+		return stopGrace
+	}
+	return j.StopGrace
+}
+
+// kill signals SIGKILL unless the attempt with pid stops within grace
+func (j *Job) kill(pid int, grace time.Duration) {
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	select {
+	case <-j.doneCh:
+		return
+	case <-timer.C:
+	}
+
+	j.rw.RLock()
+	running := j.attempt.Pid == pid && j.attempt.StoppedAt.IsZero()
+	j.rw.RUnlock()
+	if running {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+	}
+}
+
+// Pause freezes all processes of the running job until Resume
+func (j *Job) Pause() error {
+	return j.pause(true)
+}
+
+// Resume thaws all processes of the paused job
+func (j *Job) Resume() error {
+	return j.pause(false)
+}
+
+func (j *Job) pause(frozen bool) error {
+	j.rw.Lock()
+	defer j.rw.Unlock()
+
+	if j.status.Stopped() || j.cgroup == nil || !j.attempt.StoppedAt.IsZero() {
+		return ErrNotRunning
+	}
+	if j.status.Paused == frozen {
+		return nil
+	}
+	if err := setFrozen(j.cgroup, frozen); err != nil {
+		return fmt.Errorf("freeze: %w", err)
+	}
+	j.status.Paused = frozen
+
+	ev := Event{Type: EventResumed, Pid: j.attempt.Pid}
+	if frozen {
+		ev.Type = EventPaused
+	}
+	j.events.emit(ev)
 	return nil
 }
 
@@ -260,6 +843,10 @@ func (j *Job) Stop() error {
 func (j *Job) Status() Status {
 	j.rw.RLock()
 	out := j.status
+	out.Attempts = slices.Clone(out.Attempts)
+	if j.writer != nil {
+		out.Truncated = j.writer.Truncated()
+	}
 
 	// calculate ran duration
 	if out.Ran == 0 {
@@ -269,16 +856,125 @@ func (j *Job) Status() Status {
 	return out
 }
 
+// LogPath returns the path of the log file or empty if never started
+func (j *Job) LogPath() string {
+	j.rw.RLock()
+	defer j.rw.RUnlock()
+	return j.logPath
+}
+
+// LogSize returns the bytes written to the logs or zero if none
+func (j *Job) LogSize() int64 {
+	path := j.LogPath()
+	if path == "" || atomic.LoadInt32(&j.state) == removed {
+		return 0
+	}
+	var size int64
+	for _, s := range segmentsOf(path) {
+		size += s.info.Size()
+	}
+	return size
+}
+
 // Done returns true if the Job completed
 func (j *Job) Done() bool {
-	return atomic.LoadInt32(&j.state) == stopped
+	return atomic.LoadInt32(&j.state) >= stopped
+}
+
+// Remove deletes the logs of the stopped job and closes all subscribers of its
+// events. A running job is refused with ErrStillRunning unless forced to stop.
+func (j *Job) Remove(force bool) error {
+	// never start once removed
+	if atomic.CompareAndSwapInt32(&j.state, created, started) {
+		j.finish(ErrRemoved)
+	}
+	if atomic.LoadInt32(&j.state) == started {
+		if !force {
+			return ErrStillRunning
+		}
+		_ = j.Stop()
+		<-j.doneCh
+	}
+	if !atomic.CompareAndSwapInt32(&j.state, stopped, removed) {
+		return ErrRemoved
+	}
+
+	if path := j.LogPath(); path != "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove logs: %w", err)
+		}
+		removeOlder(path)
+		_ = os.Remove(path + exitSuffix)
+		if filepath.Base(path) == logName {
+			_ = os.Remove(filepath.Dir(path))
+		}
+	}
+	j.events.emit(Event{Type: EventRemoved})
+	return nil
 }
 
 // Logs returns JobReader for polling logs until process stops
 func (j *Job) Logs(ctx context.Context) (io.ReadCloser, error) {
-	// no logs if never started
-	if atomic.LoadInt32(&j.state) == created {
+	r, err := j.LogsWith(ctx, LogOptions{Follow: true})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LogsWith returns JobReader of the logs selected by opts, at the start of a
+// record if framed
+func (j *Job) LogsWith(ctx context.Context, opts LogOptions) (*JobReader, error) {
+	// no logs if never started or removed
+	switch atomic.LoadInt32(&j.state) {
+	case created:
+		return nil, ErrNotStarted
+	case removed:
+		return nil, ErrRemoved
+	}
+	path := j.LogPath()
+	if path == "" {
 		return nil, ErrNotStarted
 	}
-	return NewJobReader(ctx, j.logs.Name(), j)
+	start, pending, err := startOf(segmentsOf(path), j.LogFormat == LogFramed, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Follow && !j.Done() {
+		r, err := j.subscribe(ctx, path, start)
+		if err != nil {
+			return nil, err
+		}
+		r.pending = pending
+		return r, nil
+	}
+	r, err := newJobReader(ctx, path, j, opts.Follow)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		r.Close()
+		return nil, err
+	}
+	r.pending = pending
+	return r, nil
+}
+
+// subscribe returns the JobReader following the logs at path from the offset
+// through the LogBroadcaster shared by all followers
+func (j *Job) subscribe(ctx context.Context, path string, offset int64) (*JobReader, error) {
+	j.hubMu.Lock()
+	defer j.hubMu.Unlock()
+	// closed once its last follower left
+	if j.hub != nil {
+		if r, err := j.hub.Subscribe(ctx, offset); err == nil {
+			return r, nil
+		}
+	}
+	hub, err := NewLogBroadcaster(path, j)
+	if err != nil {
+		return nil, err
+	}
+	j.hub = hub
+	return hub.Subscribe(ctx, offset)
 }
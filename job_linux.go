@@ -2,14 +2,19 @@ package tjob
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/sys/unix"
@@ -19,21 +24,124 @@ const (
 	cgroupRoot     = "/sys/fs/cgroup"
 	cpuPeriod      = 100000
 	cgroupFileMode = 0o500
+	signalBuffer   = 32
+	signalExit     = 128
+	// highest signal number of linux
+	maxSignal = 64
+
+	// first of os/exec.Cmd.ExtraFiles in the jail
+	syncFd = 3
+	// exit status file of the jail next to the logs
+	exitFd     = 4
+	exitSuffix = ".exit"
+	// most often cgroup.events is polled for reattached jobs
+	reattachPoll = time.Second
+	// attempts to open segments of logs rotated meanwhile
+	segmentRetries = 3
+
+	handshakeTimeout = 10 * time.Second
+	opMount          = "mount"
+	opNet            = "net"
+	opExec           = "exec"
+	opRun            = "run"
 )
 
+// initReport is the op the jail reached and any error it sends to the parent over the sync pipe
+type initReport struct {
+	Op    string `json:"op"`
+	Errno int    `json:"errno"`
+	Msg   string `json:"msg"`
+}
+
 // NewJob creates Job for the given command path and args until Start()
 func NewJob(path string, args ...string) *Job {
 	status := Status{
 		Cmd: strings.Join(append([]string{path}, args...), " "),
 	}
-	return &Job{
+	job := &Job{
 		Id:       uuid.New().String(),
 		jailPath: "/proc/self/exe",
 		Path:     path,
 		Args:     args,
 		status:   status,
 		doneCh:   make(chan bool),
+		stopCh:   make(chan struct{}),
+	}
+	job.events.emit(Event{Type: EventCreated})
+	return job
+}
+
+// ReattachJob returns the job with the id, last status and logs at logPath
+// started by an earlier process, tracking it until it stops if its jail still
+// runs in its cgroup, or stopped with the exit code the jail left otherwise.
+// Neither restarts, timeouts nor health checks apply to it.
+func ReattachJob(id string, status Status, logPath string) *Job {
+	job := &Job{
+		Id:      id,
+		logPath: logPath,
+		status:  status,
+		state:   started,
+		doneCh:  make(chan bool),
+		stopCh:  make(chan struct{}),
+		attempt: Attempt{Pid: status.Pid, StartedAt: status.StartedAt},
+	}
+	cgroupJob := cgroupOf(id)
+	if cgroup, err := os.Open(cgroupJob); err == nil {
+		job.cgroup = cgroup
+	}
+	job.events.emit(Event{Type: EventStarted, Pid: status.Pid})
+	if job.cgroup != nil && populated(cgroupJob) && inCgroup(status.Pid, cgroupJob) {
+		go job.poll()
+	} else {
+		job.reattached()
 	}
+	return job
+}
+
+// poll waits for the last process of the cgroup of the reattached job to exit
+// since the job is no longer a child to wait on
+func (j *Job) poll() {
+	ticker := time.NewTicker(reattachPoll)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !populated(j.cgroup.Name()) {
+			j.reattached()
+			return
+		}
+	}
+}
+
+// reattached finishes the reattached job with the exit code left by its jail
+func (j *Job) reattached() {
+	exit, sig, err := readExit(j.logPath)
+	if err != nil {
+		// the jail leaves no exit code once killed
+		j.rw.RLock()
+		stopped := j.status.Error != nil
+		j.rw.RUnlock()
+		if exit, err = -1, ErrExitUnknown; stopped {
+			exit, sig, err = signalExit+int32(syscall.SIGKILL), syscall.SIGKILL, nil
+		}
+	}
+	j.exited(exit, sig)
+	j.finish(err)
+}
+
+// RestoreJob returns the stopped job with the id, final status and logs at
+// logPath of an earlier process, e.g. to keep the history across restarts.
+func RestoreJob(id string, status Status, logPath string) *Job {
+	job := &Job{
+		Id:      id,
+		logPath: logPath,
+		status:  status,
+		state:   stopped,
+		doneCh:  make(chan bool),
+		stopCh:  make(chan struct{}),
+	}
+	close(job.doneCh)
+	close(job.stopCh)
+	job.events.emit(Event{Type: EventExited, Time: status.StoppedAt, Pid: status.Pid, Exit: status.Exit})
+	return job
 }
 
 func mount() error {
@@ -44,14 +152,221 @@ func mount() error {
 	return nil
 }
 
+// syncPipe returns the jail end of the sync pipe hidden from the command
+func syncPipe() *os.File {
+	unix.CloseOnExec(syncFd)
+	return os.NewFile(syncFd, "sync")
+}
+
+// exitFile returns the jail end of the exit status file hidden from the command
+func exitFile() *os.File {
+	unix.CloseOnExec(exitFd)
+	return os.NewFile(exitFd, "exit")
+}
+
+// writeExit leaves the exit code and any signal that killed the command in the
+// status file for a parent reattached after a restart, since it can no longer
+// wait on the jail, or to tell signals from exit codes above 128
+func writeExit(file *os.File, code int, sig syscall.Signal) {
+	_, _ = fmt.Fprintf(file, "%d %d\n", code, int(sig))
+	file.Close()
+}
+
+// readExit returns the exit code and signal the jail left in the status file
+// next to the logs. Jails leaving no signal report it as 128 + signal.
+func readExit(logPath string) (int32, syscall.Signal, error) {
+	data, err := os.ReadFile(logPath + exitSuffix)
+	if err != nil {
+		return 0, 0, fmt.Errorf("exit file: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("exit file: %w", io.ErrUnexpectedEOF)
+	}
+	code, err := strconv.ParseInt(fields[0], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("exit file: %w", err)
+	}
+	if len(fields) < 2 {
+		return int32(code), signalOfExit(int32(code)), nil
+	}
+	sig, err := strconv.ParseInt(fields[1], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("exit file: %w", err)
+	}
+	return int32(code), syscall.Signal(sig), nil
+}
+
+// cgroupOf returns the path of the cgroup of the job id
+func cgroupOf(id string) string {
+	return fmt.Sprintf("%s/%s%s", cgroupRoot, orphanPrefix, id)
+}
+
+// populated returns true if any process still runs in the cgroup
+func populated(cgroup string) bool {
+	data, err := os.ReadFile(cgroup + "/cgroup.events")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "populated "); ok {
+			return v == "1"
+		}
+	}
+	return false
+}
+
+// inCgroup returns true if pid belongs to the cgroup, e.g. not reused since
+func inCgroup(pid int, cgroup string) bool {
+	data, err := os.ReadFile(cgroup + "/cgroup.procs")
+	if err != nil {
+		return false
+	}
+	return slices.Contains(strings.Fields(string(data)), strconv.Itoa(pid))
+}
+
+// report sends op and err over the sync pipe for the parent to return from Start
+func report(pipe *os.File, op string, err error) error {
+	out := initReport{Op: op}
+	if err != nil {
+		out.Msg = err.Error()
+	}
+	var errno syscall.Errno
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		out.Errno = int(unix.ENOENT)
+	case errors.As(err, &errno):
+		out.Errno = int(errno)
+	}
+	if data, jerr := json.Marshal(out); jerr == nil {
+		_, _ = pipe.Write(data)
+	}
+	pipe.Close()
+	if err != nil {
+		return fmt.Errorf("init %s: %w", op, err)
+	}
+	return nil
+}
+
+// handshake blocks until the jail closes the sync pipe and returns any error
+// it reported. A binary not importing tjob reports nothing before it exits or
+// the timeout.
+func handshake(pipe *os.File) error {
+	_ = pipe.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	data, err := io.ReadAll(pipe)
+	if errors.Is(err, os.ErrDeadlineExceeded) && len(data) == 0 {
+		return fmt.Errorf("%w: %w", ErrInitMissing, ErrHandshakeTimeout)
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return ErrHandshakeTimeout
+	}
+	if err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	if len(data) == 0 {
+		return ErrInitMissing
+	}
+	var ir initReport
+	if err := json.Unmarshal(data, &ir); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	return ir.err()
+}
+
+// err maps the reported op and errno to the typed errors of Start
+func (e initReport) err() error {
+	switch e.Op {
+	case opRun:
+		return nil
+	}
+	errno := syscall.Errno(e.Errno)
+	target := ErrJailFailed
+	switch {
+	case e.Op == opMount:
+		target = ErrMountFailed
+	case errno == unix.ENOENT:
+		target = ErrExecNotFound
+	case errno == unix.EACCES || errno == unix.EPERM:
+		target = ErrExecDenied
+	}
+	return fmt.Errorf("%w: %s", target, e.Msg)
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// supervise runs cmd as a minimal init that forwards signals to its process
+// group and reaps re-parented children until cmd exits with its code.
+// The sync pipe reports the run once cmd starts.
+func supervise(cmd *exec.Cmd, pipe *os.File) (int, syscall.Signal, error) {
+	// subscribe before start so no SIGCHLD is missed
+	sigs := make(chan os.Signal, signalBuffer)
+	signal.Notify(sigs)
+	defer signal.Stop(sigs)
+
+	// own process group to signal the command with all its children
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, 0, fmt.Errorf("start: %w", err)
+	}
+	_ = report(pipe, opRun, nil)
+	pid := cmd.Process.Pid
+
+	for sig := range sigs {
+		switch sig {
+		case unix.SIGCHLD:
+			if code, sig, exited := reap(pid); exited {
+				return code, sig, nil
+			}
+		case unix.SIGURG:
+			// runtime preemption meant for this process only
+		default:
+			if s, ok := sig.(syscall.Signal); ok {
+				_ = unix.Kill(-pid, s)
+			}
+		}
+	}
+	return 0, 0, nil
+}
+
+// reap waits on all exited children and returns the exit code and any signal
+// that killed pid once it exits. Signal deaths follow the shell convention of
+// 128 + signal.
+func reap(pid int) (int, syscall.Signal, bool) {
+	code, sig, exited := 0, syscall.Signal(0), false
+	for {
+		var ws unix.WaitStatus
+		child, err := unix.Wait4(-1, &ws, unix.WNOHANG, nil)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		// no more children to reap for now
+		if err != nil || child <= 0 {
+			return code, sig, exited
+		}
+		if child != pid {
+			continue
+		}
+		switch {
+		case ws.Exited():
+			code, exited = ws.ExitStatus(), true
+		case ws.Signaled():
+			code, sig, exited = signalExit+int(ws.Signal()), ws.Signal(), true
+		}
+	}
+}
+
 // jail creates the namespaces required by the job to isolate exec.Cmd
-func jail(ctx context.Context, job *Job) (*exec.Cmd, error) {
-	cgroupJob := fmt.Sprintf("%s/%s", cgroupRoot, job.Id)
-	cgroupJail := fmt.Sprintf("%s/jail", cgroupJob) //nolint:perfsprint
+// and returns the parent end of the sync pipe for the handshake.
+func jail(ctx context.Context, job *Job) (*exec.Cmd, *os.File, error) {
+	cgroupJob := cgroupOf(job.Id)
 
-	// create a directory structure like /sys/fs/cgroup/<job_id>/jail
-	if err := os.MkdirAll(cgroupJail, cgroupFileMode); err != nil {
-		return nil, fmt.Errorf("mkdir %s: %w", cgroupJob, err)
+	// create a directory like /sys/fs/cgroup/tjob-<job_id>
+	if err := os.Mkdir(cgroupJob, cgroupFileMode); err != nil {
+		return nil, nil, fmt.Errorf("mkdir %s: %w", cgroupJob, err)
 	}
 	// remove dir if failed
 	defer func() {
@@ -63,7 +378,7 @@ func jail(ctx context.Context, job *Job) (*exec.Cmd, error) {
 	// enable cpu, io, and memory controllers
 	path := cgroupRoot + "/cgroup.subtree_control"
 	if err := os.WriteFile(path, []byte("+cpu +io +memory"), cgroupFileMode); err != nil {
-		return nil, fmt.Errorf("%s: %w", path, err)
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
 	}
 	// limit cpu
 	if job.CPUPercent > 0 {
@@ -71,71 +386,179 @@ func jail(ctx context.Context, job *Job) (*exec.Cmd, error) {
 		content := fmt.Sprintf("%d %d", int(n), cpuPeriod)
 		path = cgroupJob + "/cpu.max"
 		if err := os.WriteFile(path, []byte(content), cgroupFileMode); err != nil {
-			return nil, fmt.Errorf("%s: %w", path, err)
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
 		}
 	}
 
 	// limit memory
 	path = cgroupJob + "/memory.max"
 	if err := os.WriteFile(path, []byte(fmt.Sprintf("%dM", job.MemoryMB)), cgroupFileMode); err != nil {
-		return nil, fmt.Errorf("%s: %w", path, err)
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
 	}
 
 	// limit rbps and wbps
 	content := fmt.Sprintf("%s rbps=%d wbps=%d riops=max wiops=max", job.Mnt, job.ReadBPS, job.WriteBPS)
 	path = cgroupJob + "/io.max"
 	if err := os.WriteFile(path, []byte(content), cgroupFileMode); err != nil {
-		return nil, fmt.Errorf("%s: %w", path, err)
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
 	}
 
 	// open cgroup file to jail clone
 	cgroup, err := os.OpenFile(cgroupJob, os.O_RDONLY, 0)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", cgroupJob, err)
+		return nil, nil, fmt.Errorf("%s: %w", cgroupJob, err)
 	}
 
+	// sync pipe for the jail to report errors before running the command
+	pipe, child, err := os.Pipe()
+	if err != nil {
+		cgroup.Close()
+		return nil, nil, fmt.Errorf("sync pipe: %w", err)
+	}
+	// exit status file for the jail to report its exit code
+	exit, err := os.OpenFile(job.logPath+exitSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		cgroup.Close()
+		closeFiles([]*os.File{pipe, child})
+		return nil, nil, fmt.Errorf("exit file: %w", err)
+	}
+
+	// prefer the init helper over re-executing self
+	exe := job.jailPath
+	if job.InitPath != "" {
+		exe = job.InitPath
+	}
 	args := append([]string{jailOp, job.Path}, job.Args...)
-	cmd := exec.CommandContext(ctx, job.jailPath, args...)
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Env = append(os.Environ(), jailEnv+"=1")
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Cloneflags:   syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET,
 		Unshareflags: syscall.CLONE_NEWNS,
 		CgroupFD:     int(cgroup.Fd()),
 		UseCgroupFD:  true,
 	}
+	cmd.ExtraFiles = []*os.File{child, exit}
+	job.rw.Lock()
 	job.cgroup = cgroup
+	job.rw.Unlock()
 
-	return cmd, nil
+	return cmd, pipe, nil
 }
 
-// NewJobReader returns the io.ReadCloser
-func NewJobReader(ctx context.Context, filename string, doner Doner) (io.ReadCloser, error) {
-	log, err := os.OpenFile(filename, os.O_RDONLY, 0o660)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", filename, err)
+// setFrozen freezes or thaws all processes in the cgroup
+func setFrozen(cgroup *os.File, frozen bool) error {
+	content := "0"
+	if frozen {
+		content = "1"
 	}
-	// reader specific notify
-	desc, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
-	if err != nil {
-		defer log.Close()
-		return nil, fmt.Errorf("inotify_init1: %w", err)
+	path := cgroup.Name() + "/cgroup.freeze"
+	if err := os.WriteFile(path, []byte(content), cgroupFileMode); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
 	}
-	// watch for writes and close event
-	_, err = syscall.InotifyAddWatch(desc, log.Name(), syscall.IN_MODIFY|syscall.IN_CLOSE)
+	return nil
+}
+
+// oomKilled returns true if the OOM killer killed any process in the cgroup
+func oomKilled(cgroup *os.File) bool {
+	data, err := os.ReadFile(cgroup.Name() + "/memory.events")
 	if err != nil {
-		return nil, fmt.Errorf("inotify_add_watch: %w", err)
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if count, ok := strings.CutPrefix(line, "oom_kill "); ok {
+			return count != "0"
+		}
+	}
+	return false
+}
+
+// exitOf returns the exit code of the jail or 128 + signal if killed
+func exitOf(state *os.ProcessState) int32 {
+	if state == nil {
+		return 0
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return int32(signalExit + int(ws.Signal()))
+	}
+	return int32(state.ExitCode())
+}
+
+// signalOf returns the signal that killed the jail or the command it ran as
+// reported in the status file next to the logs
+func signalOf(state *os.ProcessState, logPath string) syscall.Signal {
+	if state == nil {
+		return 0
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal()
+	}
+	if _, sig, err := readExit(logPath); err == nil {
+		return sig
+	}
+	return signalOfExit(int32(state.ExitCode()))
+}
+
+// signalOfExit returns the signal of the exit code 128 + signal, or zero for
+// any other code
+func signalOfExit(code int32) syscall.Signal {
+	if code > signalExit && code <= signalExit+maxSignal {
+		return syscall.Signal(code - signalExit)
+	}
+	return 0
+}
+
+// NewJobReader returns the io.ReadCloser of the logs at filename, including
+// any older segments rotated, until the Job stops
+func NewJobReader(ctx context.Context, filename string, doner Doner) (io.ReadCloser, error) {
+	return newJobReader(ctx, filename, doner, true)
+}
+
+// newJobReader returns the JobReader of the logs at filename from the oldest
+// segment kept, following them until the Job stops unless not follow
+func newJobReader(ctx context.Context, filename string, doner Doner, follow bool) (*JobReader, error) {
+	r := &JobReader{ctx: ctx, doner: doner, path: filename, follow: follow}
+	if follow {
+		// reader specific notify
+		desc, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+		if err != nil {
+			return nil, fmt.Errorf("inotify_init1: %w", err)
+		}
+		r.inotify = os.NewFile(uintptr(desc), filename)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		r.Close()
+		return nil, err
 	}
 	// close file to unblock reads if context is done
-	file := os.NewFile(uintptr(desc), log.Name())
 	go func() {
 		<-ctx.Done()
-		file.Close()
-		log.Close()
+		if r.inotify != nil {
+			r.inotify.Close()
+		}
+		r.mu.Lock()
+		r.logs.Close()
+		r.mu.Unlock()
 	}()
-	return &JobReader{doner: doner, logs: log, inotify: file}, nil
+	return r, nil
 }
 
 // Read reads n bytes into buffer and return EOF only when Job stops
-func (r *JobReader) Read(buffer []byte) (n int, err error) { //nolint:nonamedreturns
+func (r *JobReader) Read(buffer []byte) (int, error) {
+	// the record pending first from the middle of framed logs
+	if len(r.pending) > 0 {
+		n := copy(buffer, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+	if r.hub != nil {
+		return r.readHub(buffer)
+	}
+	return r.readFile(buffer)
+}
+
+// readFile reads the segments of the logs, waiting for more if followed until
+// the Job stops
+func (r *JobReader) readFile(buffer []byte) (n int, err error) { //nolint:nonamedreturns
 	for n == 0 && err == nil {
 		n, err = r.logs.Read(buffer)
 
@@ -144,13 +567,21 @@ func (r *JobReader) Read(buffer []byte) (n int, err error) { //nolint:nonamedret
 			return n, io.EOF
 		}
 
+		// continue in the next segment once rotated
+		if n == 0 && err == io.EOF && r.next() {
+			err = nil
+			continue
+		}
+
 		// wait and ignore EOF until stopped
-		if n == 0 && err == io.EOF && !r.doner.Done() {
-			// sufficiently size buffer for events
-			b := make([]byte, syscall.SizeofInotifyEvent*syscall.NAME_MAX+1)
+		if n == 0 && err == io.EOF && r.follow && !r.doner.Done() {
+			// sufficiently size buffer for events once
+			if r.events == nil {
+				r.events = make([]byte, syscall.SizeofInotifyEvent*syscall.NAME_MAX+1)
+			}
 
 			// return EOF if file close by context
-			if _, err = r.inotify.Read(b); errors.Is(err, fs.ErrClosed) {
+			if _, err = r.inotify.Read(r.events); errors.Is(err, fs.ErrClosed) {
 				return 0, io.EOF
 			}
 			// clear EOF and try again
@@ -160,8 +591,156 @@ func (r *JobReader) Read(buffer []byte) (n int, err error) { //nolint:nonamedret
 	return
 }
 
+// Seek sets the offset in all logs ever written for the next Read, or in the
+// oldest segment kept if dropped since, and returns it
+func (r *JobReader) Seek(offset int64, whence int) (int64, error) {
+	for range segmentRetries {
+		segments := segmentsOf(r.path)
+		if len(segments) == 0 {
+			return 0, fmt.Errorf("%s: %w", r.path, os.ErrNotExist)
+		}
+		switch whence {
+		case io.SeekCurrent:
+			offset += r.position()
+		case io.SeekEnd:
+			offset += segments[len(segments)-1].end()
+		}
+		whence, offset = io.SeekStart, max(offset, segments[0].base)
+
+		// the last segment starting at or before the offset
+		i := len(segments) - 1
+		for i > 0 && segments[i].base > offset {
+			i--
+		}
+		file, err := r.open(segments[i])
+		if err != nil {
+			// rotated meanwhile
+			continue
+		}
+		if _, err := file.Seek(offset-segments[i].base, io.SeekStart); err != nil {
+			file.Close()
+			return 0, fmt.Errorf("seek: %w", err)
+		}
+		if !r.swap(file, segments[i].base) {
+			return 0, fmt.Errorf("seek: %w", r.ctx.Err())
+		}
+		r.offset, r.pending = offset, nil
+		return offset, nil
+	}
+	return 0, fmt.Errorf("seek %s: %w", r.path, os.ErrNotExist)
+}
+
+// Offset returns the offset in all logs ever written of the next Read. Any
+// record pending from the middle of framed logs ends at the offset after it.
+func (r *JobReader) Offset() int64 {
+	return r.position() - int64(len(r.pending))
+}
+
+// position returns the offset in all logs ever written read so far
+func (r *JobReader) position() int64 {
+	if r.hub != nil {
+		return r.offset
+	}
+	return r.fileOffset()
+}
+
+// fileOffset returns the offset in all logs ever written of the segment read
+func (r *JobReader) fileOffset() int64 {
+	if r.logs == nil {
+		return r.base
+	}
+	offset, err := r.logs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return r.base
+	}
+	return r.base + offset
+}
+
+// next switches to the segment of the logs after the one read so far unless
+// still the latest. The older segment continues in the one after unless
+// dropped for the next rotated meanwhile.
+func (r *JobReader) next() bool {
+	current, err := r.logs.Stat()
+	if err != nil {
+		return false
+	}
+	end := r.base + current.Size()
+	for range segmentRetries {
+		var next *segment
+		segments := segmentsOf(r.path)
+		for i, s := range segments {
+			if os.SameFile(s.info, current) {
+				continue
+			}
+			if s.base >= end {
+				next = &segments[i]
+				break
+			}
+		}
+		if next == nil {
+			return false
+		}
+		file, err := r.open(*next)
+		if err != nil {
+			// rotated meanwhile
+			continue
+		}
+		return r.swap(file, next.base)
+	}
+	return false
+}
+
+// open opens the segment watching for writes and close events
+func (r *JobReader) open(s segment) (*os.File, error) {
+	file, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	if r.inotify == nil {
+		return file, nil
+	}
+	// watch without Fd() turning the inotify blocking so close unblocks it
+	conn, err := r.inotify.SyscallConn()
+	if err == nil {
+		_ = conn.Control(func(fd uintptr) {
+			_, err = syscall.InotifyAddWatch(int(fd), s.path, syscall.IN_MODIFY|syscall.IN_CLOSE)
+		})
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("inotify_add_watch: %w", err)
+	}
+	return file, nil
+}
+
+// swap reads the file at base from now on unless closed by context
+func (r *JobReader) swap(file *os.File, base int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// never leak the segment once closed by context
+	if r.ctx.Err() != nil {
+		file.Close()
+		return false
+	}
+	if r.logs != nil {
+		r.logs.Close()
+	}
+	r.logs, r.base = file, base
+	return true
+}
+
 func (r *JobReader) Close() error {
-	_ = r.inotify.Close()
+	if r.inotify != nil {
+		_ = r.inotify.Close()
+	}
+	if r.leave != nil {
+		r.leave()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.logs == nil {
+		return nil
+	}
 	if err := r.logs.Close(); err != nil {
 		return fmt.Errorf("reader close: %w", err)
 	}
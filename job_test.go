@@ -1,9 +1,18 @@
 package tjob_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -65,6 +74,44 @@ func TestJobReader(t *testing.T) {
 	}
 }
 
+func TestJobReaderRotated(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "output.log")
+	tmp, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unexpected log file: %v", err)
+	}
+	_, _ = tmp.WriteString("Hello")
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+
+	// mock job rotating its logs as the older segment into a new log file
+	job := JobMock{}
+	go func() {
+		<-time.After(time.Second)
+		_ = os.Rename(path, path+".0")
+		_ = os.WriteFile(path, []byte("World"), 0o600)
+		tmp.Close()
+
+		_ = job.SetDone()
+	}()
+	sut, err := tjob.NewJobReader(ctx, path, &job)
+	if err != nil {
+		t.Fatalf("unexpected reader: %v", err)
+	}
+	defer func() { sut.Close() }()
+
+	out, err := io.ReadAll(sut)
+	if err != nil {
+		t.Fatalf("unexpected read: %v", err)
+	}
+	if string(out) != "HelloWorld" {
+		t.Errorf("expected out(%s) == HelloWorld", out)
+	}
+}
+
 func TestJobReaderCancelled(t *testing.T) {
 	t.Parallel()
 
@@ -110,3 +157,532 @@ func TestJobReaderCancelled(t *testing.T) {
 		t.Errorf("expected out(%s) == Hello", out)
 	}
 }
+
+func TestStatusReason(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	tests := []struct {
+		status tjob.Status
+		reason string
+	}{
+		{tjob.Status{}, ""},
+		{tjob.Status{StoppedAt: now}, "exited"},
+		{tjob.Status{StoppedAt: now, Error: tjob.ErrForceStop}, "stopped"},
+		{tjob.Status{StoppedAt: now, Error: tjob.ErrTimedOut}, "timed out"},
+		{tjob.Status{StoppedAt: now, Error: tjob.ErrIdleTimedOut}, "timed out"},
+	}
+	for _, test := range tests {
+		if reason := test.status.Reason(); reason != test.reason {
+			t.Errorf("expected reason(%s) == %s", reason, test.reason)
+		}
+	}
+}
+
+func TestInitReportErr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		op    string
+		errno syscall.Errno
+		err   error
+	}{
+		{"run", 0, nil},
+		{"mount", syscall.EPERM, tjob.ErrMountFailed},
+		{"mount", syscall.ENOENT, tjob.ErrMountFailed},
+		{"exec", syscall.ENOENT, tjob.ErrExecNotFound},
+		{"exec", syscall.EACCES, tjob.ErrExecDenied},
+		{"exec", syscall.EPERM, tjob.ErrExecDenied},
+		{"exec", syscall.ENOEXEC, tjob.ErrJailFailed},
+		{"net", 0, tjob.ErrJailFailed},
+	}
+	for _, test := range tests {
+		err := tjob.InitReportErr(test.op, test.errno, "failed")
+		if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+			t.Errorf("%s(%v): expected err(%v) == %v", test.op, test.errno, err, test.err)
+		}
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		report string
+		err    error
+	}{
+		{"run", `{"op":"run"}`, nil},
+		{"mount", `{"op":"mount","errno":1,"msg":"denied"}`, tjob.ErrMountFailed},
+		// binary not importing tjob exited without a report
+		{"missing", "", tjob.ErrInitMissing},
+	}
+	for _, test := range tests {
+		pipe, child, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("unexpected pipe: %v", err)
+		}
+		_, _ = child.WriteString(test.report)
+		child.Close()
+		err = tjob.Handshake(pipe)
+		pipe.Close()
+		if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+			t.Errorf("%s: expected err(%v) == %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestJailWithoutInit(t *testing.T) {
+	t.Parallel()
+
+	// jail exits non-zero before main without the command to run
+	cmd := exec.Command(build(t, "./testdata/noinit"), ".tjob")
+	cmd.Env = append(os.Environ(), "TJOB_JAIL=1")
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Errorf("expected exit 1: %v", err)
+	}
+	if len(out) > 0 {
+		t.Errorf("unexpected main: %q", out)
+	}
+}
+
+func TestJobWithoutInit(t *testing.T) {
+	t.Parallel()
+
+	// binary never calling Init() still runs the command in the jail at once
+	requireJail(t)
+	job := jailed(t, build(t, "./testdata/noinit"), "echo", "jailed")
+	start := time.Now()
+	if err := job.Start(context.TODO()); err != nil {
+		t.Fatalf("unexpected start: %v", err)
+	}
+	if err := job.Wait(); err != nil {
+		t.Fatalf("unexpected wait: %v", err)
+	}
+	if ran := time.Since(start); ran > 5*time.Second {
+		t.Errorf("expected ran(%v) <= 5s", ran)
+	}
+	logs, err := os.ReadFile(job.LogPath())
+	if err != nil || string(logs) != "jailed\n" {
+		t.Errorf("expected logs(%q) == jailed: %v", logs, err)
+	}
+}
+
+func TestRestoreJob(t *testing.T) {
+	t.Parallel()
+
+	tmp, err := os.CreateTemp(t.TempDir(), "*")
+	if err != nil {
+		t.Fatalf("unexpected tmp file: %v", err)
+	}
+	_, _ = tmp.WriteString("Hello")
+	tmp.Close()
+
+	now := time.Now()
+	sut := tjob.RestoreJob("abc", tjob.Status{Cmd: "echo Hello", StartedAt: now, StoppedAt: now, Exit: 3}, tmp.Name())
+	if !sut.Done() {
+		t.Error("expected done")
+	}
+	if status := sut.Status(); status.Exit != 3 || status.Cmd != "echo Hello" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	if ev := <-sut.Events(ctx); ev.Type != tjob.EventExited || ev.Exit != 3 {
+		t.Errorf("expected exited event: %+v", ev)
+	}
+
+	logs, err := sut.Logs(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected logs: %v", err)
+	}
+	out, _ := io.ReadAll(logs)
+	logs.Close()
+	if string(out) != "Hello" {
+		t.Errorf("expected out(%s) == Hello", out)
+	}
+
+	if err := sut.Remove(false); err != nil {
+		t.Fatalf("unexpected remove: %v", err)
+	}
+	if _, err := os.Stat(tmp.Name()); !os.IsNotExist(err) {
+		t.Errorf("expected removed logs: %v", err)
+	}
+}
+
+func TestRemoveLogDir(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "abc")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatalf("unexpected log dir: %v", err)
+	}
+	logPath := filepath.Join(dir, "output.log")
+	if err := os.WriteFile(logPath, []byte("Hello"), 0o600); err != nil {
+		t.Fatalf("unexpected log file: %v", err)
+	}
+
+	now := time.Now()
+	sut := tjob.RestoreJob("abc", tjob.Status{Cmd: "echo Hello", StartedAt: now, StoppedAt: now}, logPath)
+	if err := sut.Remove(false); err != nil {
+		t.Fatalf("unexpected remove: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected removed log dir: %v", err)
+	}
+}
+
+func TestReattachJobExited(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	logs := dir + "/logs"
+	if err := os.WriteFile(logs, []byte("Hello"), 0o600); err != nil {
+		t.Fatalf("unexpected logs: %v", err)
+	}
+	status := tjob.Status{Pid: 1, Cmd: "echo Hello", StartedAt: time.Now()}
+
+	// no exit code left by the jail
+	sut := tjob.ReattachJob("no-such-cgroup", status, logs)
+	if err := sut.Wait(); !errors.Is(err, tjob.ErrExitUnknown) {
+		t.Errorf("expected err(%v) == %v", err, tjob.ErrExitUnknown)
+	}
+	if exit := sut.Status().Exit; exit != -1 {
+		t.Errorf("expected exit(%d) == -1", exit)
+	}
+
+	// exit code left by the jail
+	if err := os.WriteFile(logs+".exit", []byte("3\n"), 0o600); err != nil {
+		t.Fatalf("unexpected exit file: %v", err)
+	}
+	sut = tjob.ReattachJob("no-such-cgroup", status, logs)
+	if err := sut.Wait(); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if exit := sut.Status().Exit; exit != 3 {
+		t.Errorf("expected exit(%d) == 3", exit)
+	}
+}
+
+func TestReadExit(t *testing.T) {
+	t.Parallel()
+
+	logs := filepath.Join(t.TempDir(), "logs")
+	tests := []struct {
+		file string
+		exit int32
+		sig  syscall.Signal
+	}{
+		{"3 0\n", 3, 0},
+		{"137 9\n", 137, syscall.SIGKILL},
+		// command exiting with 128 + signal on its own
+		{"143 0\n", 143, 0},
+		// jails leaving no signal
+		{"143\n", 143, syscall.SIGTERM},
+		{"192\n", 192, 64},
+		{"200\n", 200, 0},
+		{"128\n", 128, 0},
+	}
+	for _, test := range tests {
+		if err := os.WriteFile(logs+".exit", []byte(test.file), 0o600); err != nil {
+			t.Fatalf("unexpected exit file: %v", err)
+		}
+		exit, sig, err := tjob.ReadExit(logs)
+		if err != nil {
+			t.Errorf("%q: unexpected err: %v", test.file, err)
+			continue
+		}
+		if exit != test.exit || sig != test.sig {
+			t.Errorf("%q: expected exit(%d) == %d and signal(%d) == %d", test.file, exit, test.exit, sig, test.sig)
+		}
+	}
+}
+
+func TestJobLogsWith(t *testing.T) {
+	t.Parallel()
+
+	// raw logs rotated into an older segment at offset 0
+	dir := t.TempDir()
+	path := filepath.Join(dir, "output.log")
+	_ = os.WriteFile(path+".0", []byte("a\nb\n"), 0o600)
+	_ = os.WriteFile(path, []byte("c\nd\n"), 0o600)
+
+	now := time.Now()
+	sut := tjob.RestoreJob("abc", tjob.Status{Cmd: "echo", StartedAt: now, StoppedAt: now}, path)
+	tests := []struct {
+		opts tjob.LogOptions
+		out  string
+	}{
+		{tjob.LogOptions{}, "a\nb\nc\nd\n"},
+		{tjob.LogOptions{Tail: 1}, "d\n"},
+		{tjob.LogOptions{Tail: 3}, "b\nc\nd\n"},
+		{tjob.LogOptions{Tail: 9}, "a\nb\nc\nd\n"},
+		{tjob.LogOptions{Offset: 2}, "b\nc\nd\n"},
+		{tjob.LogOptions{Offset: 6}, "d\n"},
+		{tjob.LogOptions{Offset: 2, Tail: 1}, "d\n"},
+	}
+	for _, test := range tests {
+		logs, err := sut.LogsWith(context.TODO(), test.opts)
+		if err != nil {
+			t.Fatalf("%+v: unexpected logs: %v", test.opts, err)
+		}
+		out, _ := io.ReadAll(logs)
+		logs.Close()
+		if string(out) != test.out {
+			t.Errorf("%+v: expected out(%q) == %q", test.opts, out, test.out)
+		}
+	}
+	if _, err := sut.LogsWith(context.TODO(), tjob.LogOptions{Since: now}); !errors.Is(err, tjob.ErrNotFramed) {
+		t.Errorf("expected err(%v) == %v", err, tjob.ErrNotFramed)
+	}
+}
+
+func TestJobLogsWithFramed(t *testing.T) {
+	t.Parallel()
+
+	// framed records of 2 lines at once and then 1 line a second later
+	now := time.Now()
+	var logs []byte
+	for i, out := range []string{"a\nb\n", "c\n"} {
+		header := make([]byte, 13)
+		binary.BigEndian.PutUint64(header, uint64(now.Add(time.Duration(i)*time.Second).UnixNano()))
+		header[8] = tjob.Stdout
+		binary.BigEndian.PutUint32(header[9:], uint32(len(out)))
+		logs = append(logs, append(header, out...)...)
+	}
+	path := filepath.Join(t.TempDir(), "output.log")
+	_ = os.WriteFile(path, logs, 0o600)
+
+	sut := tjob.RestoreJob("abc", tjob.Status{Cmd: "echo", StartedAt: now, StoppedAt: now}, path)
+	sut.LogFormat = tjob.LogFramed
+	outOf := func(opts tjob.LogOptions) string {
+		logs, err := sut.LogsWith(context.TODO(), opts)
+		if err != nil {
+			t.Fatalf("%+v: unexpected logs: %v", opts, err)
+		}
+		defer logs.Close()
+		records := tjob.NewLogRecordReader(logs)
+		out := ""
+		for {
+			record, err := records.Read()
+			if err != nil {
+				return out
+			}
+			out += string(record.Out)
+		}
+	}
+	tests := []struct {
+		opts tjob.LogOptions
+		out  string
+	}{
+		{tjob.LogOptions{}, "a\nb\nc\n"},
+		{tjob.LogOptions{Tail: 2}, "b\nc\n"},
+		{tjob.LogOptions{Offset: 1}, "c\n"},
+		{tjob.LogOptions{Since: now.Add(time.Second)}, "c\n"},
+	}
+	for _, test := range tests {
+		if out := outOf(test.opts); out != test.out {
+			t.Errorf("%+v: expected out(%q) == %q", test.opts, out, test.out)
+		}
+	}
+
+	// resume after each record read, from the one pending of the tail on
+	reader, err := sut.LogsWith(context.TODO(), tjob.LogOptions{Tail: 2})
+	if err != nil {
+		t.Fatalf("unexpected logs: %v", err)
+	}
+	defer reader.Close()
+	records := tjob.NewLogRecordReader(reader)
+	for _, test := range []struct {
+		next int64
+		rest string
+	}{{17, "c\n"}, {32, ""}} {
+		if _, err := records.Read(); err != nil {
+			t.Fatalf("unexpected record: %v", err)
+		}
+		if next := reader.Offset(); next != test.next {
+			t.Errorf("expected offset(%d) == %d", next, test.next)
+		}
+		if out := outOf(tjob.LogOptions{Offset: reader.Offset()}); out != test.rest {
+			t.Errorf("expected out(%q) == %q", out, test.rest)
+		}
+	}
+}
+
+func TestJobLogsWithIndex(t *testing.T) {
+	t.Parallel()
+
+	// framed records of a line each over several marks of the index
+	path := filepath.Join(t.TempDir(), "output.log")
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		t.Fatalf("unexpected log file: %v", err)
+	}
+	writer := tjob.NewLogWriter(file, true)
+	const lines = 1000
+	for i := range lines {
+		_, _ = fmt.Fprintf(writer, "%04d %s\n", i, strings.Repeat("a", 1018))
+	}
+	writer.Close()
+	if info, err := os.Stat(path + ".idx"); err != nil || info.Size() == 0 {
+		t.Fatalf("expected index: %v", err)
+	}
+
+	now := time.Now()
+	sut := tjob.RestoreJob("abc", tjob.Status{Cmd: "echo", StartedAt: now, StoppedAt: now}, path)
+	sut.LogFormat = tjob.LogFramed
+	recordsOf := func(opts tjob.LogOptions) []tjob.LogRecord {
+		logs, err := sut.LogsWith(context.TODO(), opts)
+		if err != nil {
+			t.Fatalf("%+v: unexpected logs: %v", opts, err)
+		}
+		defer logs.Close()
+		reader := tjob.NewLogRecordReader(logs)
+		var records []tjob.LogRecord
+		for {
+			record, err := reader.Read()
+			if err != nil {
+				return records
+			}
+			records = append(records, record)
+		}
+	}
+	all := recordsOf(tjob.LogOptions{})
+	if len(all) != lines {
+		t.Fatalf("expected records(%d) == %d", len(all), lines)
+	}
+	// first record written since the time of a record well past the first mark
+	since := 0
+	for since < 700 || all[since-1].Time.Equal(all[since].Time) {
+		since++
+	}
+	tests := []struct {
+		opts  tjob.LogOptions
+		first int
+	}{
+		{tjob.LogOptions{Tail: 3}, lines - 3},
+		{tjob.LogOptions{Tail: lines}, 0},
+		{tjob.LogOptions{Offset: 600 * 1037}, 600},
+		{tjob.LogOptions{Offset: 600*1037 + 1}, 601},
+		{tjob.LogOptions{Since: all[since].Time}, since},
+	}
+	for _, test := range tests {
+		records := recordsOf(test.opts)
+		if len(records) != lines-test.first {
+			t.Errorf("%+v: expected records(%d) == %d", test.opts, len(records), lines-test.first)
+			continue
+		}
+		if first := string(records[0].Out[:4]); first != fmt.Sprintf("%04d", test.first) {
+			t.Errorf("%+v: expected first(%s) == %04d", test.opts, first, test.first)
+		}
+	}
+
+	// a corrupt index only slows down seeking
+	_ = os.WriteFile(path+".idx", bytes.Repeat([]byte{0xff}, 32), 0o600)
+	if records := recordsOf(tjob.LogOptions{Tail: 3}); len(records) != 3 {
+		t.Errorf("expected records(%d) == 3", len(records))
+	}
+}
+
+func TestJobLogsWithCorrupt(t *testing.T) {
+	t.Parallel()
+
+	// header of a record larger than any written
+	header := make([]byte, 13)
+	header[8] = tjob.Stdout
+	binary.BigEndian.PutUint32(header[9:], 1<<31)
+	path := filepath.Join(t.TempDir(), "output.log")
+	_ = os.WriteFile(path, header, 0o600)
+
+	now := time.Now()
+	sut := tjob.RestoreJob("abc", tjob.Status{Cmd: "echo", StartedAt: now, StoppedAt: now}, path)
+	sut.LogFormat = tjob.LogFramed
+	if _, err := sut.LogsWith(context.TODO(), tjob.LogOptions{Tail: 1}); !errors.Is(err, tjob.ErrLogRecord) {
+		t.Errorf("expected err(%v) == %v", err, tjob.ErrLogRecord)
+	}
+}
+
+func TestJobReapsOrphans(t *testing.T) {
+	initPath := requireJail(t)
+
+	tests := []struct {
+		name   string
+		script string
+		logs   string
+	}{
+		// orphan exiting while the job runs is reaped by the jail as pid 1
+		{"exited", `p=$(sh -c 'sleep 0.2 >/dev/null & echo $!'); sleep 1; [ -e /proc/$p ] && exit 1; echo reaped`, "reaped\n"},
+		// orphan still running dies with the jail once the job exits
+		{"running", `sleep 30 >/dev/null & echo left`, "left\n"},
+	}
+	for _, test := range tests {
+		sut := jailed(t, initPath, "sh", "-c", test.script)
+		if err := sut.Start(context.Background()); err != nil {
+			t.Fatalf("%s: unexpected start: %v", test.name, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := sut.WaitContext(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("%s: unexpected wait: %v", test.name, err)
+		}
+		if exit := sut.Status().Exit; exit != 0 {
+			t.Errorf("%s: expected exit(%d) == 0", test.name, exit)
+		}
+		if logs, err := os.ReadFile(sut.LogPath()); err != nil || string(logs) != test.logs {
+			t.Errorf("%s: expected logs(%q) == %q: %v", test.name, logs, test.logs, err)
+		}
+	}
+}
+
+func TestJobSignaled(t *testing.T) {
+	initPath := requireJail(t)
+
+	tests := []struct {
+		name   string
+		script string
+		sig    syscall.Signal
+		exit   int32
+		// signal reported as killing the job unless handled
+		signaled bool
+	}{
+		{"killed", `echo ready; sleep 30`, syscall.SIGINT, 128 + int32(syscall.SIGINT), true},
+		{"handled", `trap 'exit 7' USR1; echo ready; while true; do sleep 0.1; done`, syscall.SIGUSR1, 7, false},
+	}
+	for _, test := range tests {
+		sut := jailed(t, initPath, "sh", "-c", test.script)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		events := sut.Events(ctx)
+		if err := sut.Start(context.Background()); err != nil {
+			cancel()
+			t.Fatalf("%s: unexpected start: %v", test.name, err)
+		}
+		// signal the jail once the workload is ready for it
+		for logs, _ := os.ReadFile(sut.LogPath()); string(logs) != "ready\n" && ctx.Err() == nil; logs, _ = os.ReadFile(sut.LogPath()) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := syscall.Kill(sut.Status().Pid, test.sig); err != nil {
+			cancel()
+			t.Fatalf("%s: unexpected kill: %v", test.name, err)
+		}
+
+		var sig syscall.Signal
+		for ev := range events {
+			if ev.Type == tjob.EventSignaled {
+				sig = ev.Signal
+			}
+			if ev.Type == tjob.EventExited {
+				break
+			}
+		}
+		cancel()
+		if exit := sut.Status().Exit; exit != test.exit {
+			t.Errorf("%s: expected exit(%d) == %d", test.name, exit, test.exit)
+		}
+		if signaled := sig == test.sig; signaled != test.signaled {
+			t.Errorf("%s: expected signal(%v) reported %v", test.name, sig, test.signaled)
+		}
+	}
+}
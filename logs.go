@@ -0,0 +1,308 @@
+package tjob
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// log policies once the logs reach the LogLimit
+const (
+	LogTruncate = "truncate"
+	LogStop     = "stop"
+	LogKill     = "kill"
+)
+
+// log formats
+const (
+	LogRaw    = "raw"
+	LogFramed = "framed"
+)
+
+// streams of the output of the job in framed logs
+const (
+	Stdout = 1
+	Stderr = 2
+)
+
+const (
+	// size of the buffer copying the output of the job and most output of a
+	// framed record
+	logBuffer = 32 * 1024
+	// most time to copy the output left once the job exits
+	drainTimeout = time.Second
+	// framed record of 8 bytes of unix nanoseconds, 1 byte of stream and 4
+	// bytes of length in big endian followed by the output
+	recordHeader = 13
+	// index of framed logs next to each segment with a mark of 8 bytes of
+	// offset in the segment and 8 bytes of unix nanoseconds in big endian of
+	// the record starting at least every indexInterval bytes
+	indexSuffix   = ".idx"
+	indexMark     = 16
+	indexInterval = 256 * 1024
+)
+
+var (
+	ErrInvalidLogPolicy = errors.New("invalid log policy")
+	ErrInvalidLogFormat = errors.New("invalid log format")
+	ErrLogLimit         = errors.New("log limit exceeded")
+	ErrLogRecord        = errors.New("invalid log record")
+)
+
+type (
+	// logWriter writes the logs up to the limit per policy: truncate rotates
+	// the log file into 2 segments of half the limit each dropping the older
+	// one, stop drops any more output and kill also stops the job. Framed
+	// records are written or dropped whole.
+	logWriter struct {
+		mu     sync.Mutex
+		file   *os.File
+		size   int64 // bytes of the file
+		base   int64 // offset of the file in all logs ever written
+		older  string
+		limit  int64
+		policy string
+		framed bool
+
+		// bytes written by the job including those dropped
+		written int64
+
+		// index of the records of the file if framed, once any marked
+		index  *os.File
+		marked int64 // offset in the file of the last record marked
+
+		// true once any output was dropped
+		truncated bool
+
+		// exceeded is called once the logs exceed the limit with kill policy
+		exceeded func()
+	}
+
+	// LogRecord is the output of the job written at once in framed logs
+	LogRecord struct {
+		Time   time.Time
+		Stream int // Stdout or Stderr
+		Out    []byte
+	}
+
+	// LogRecordReader reads the LogRecord of framed logs in order
+	LogRecordReader struct {
+		r      io.Reader
+		header [recordHeader]byte
+	}
+)
+
+// ParseLogPolicy parses truncate (default if empty), stop, or kill
+func ParseLogPolicy(s string) (string, error) {
+	switch s {
+	case "":
+		return LogTruncate, nil
+	case LogTruncate, LogStop, LogKill:
+		return s, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidLogPolicy, s)
+	}
+}
+
+// ParseLogFormat parses raw (default if empty) or framed
+func ParseLogFormat(s string) (string, error) {
+	switch s {
+	case "":
+		return LogRaw, nil
+	case LogRaw, LogFramed:
+		return s, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidLogFormat, s)
+	}
+}
+
+// Write writes the output of the job to stdout
+func (w *logWriter) Write(p []byte) (int, error) {
+	return w.WriteStream(Stdout, p)
+}
+
+// WriteStream writes the output of the job to the stream, framed as records
+// of the time written if framed
+func (w *logWriter) WriteStream(stream int, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, at := len(p), time.Now()
+	w.written += int64(n)
+	header := int64(0)
+	if w.framed {
+		header = recordHeader
+	}
+	truncating := w.limit > 0 && w.policy == LogTruncate
+	if w.limit > 0 && !truncating {
+		if room := max(w.limit-w.size-header, 0); int64(len(p)) > room {
+			p = p[:room]
+			if !w.truncated && w.policy == LogKill && w.exceeded != nil {
+				go w.exceeded()
+			}
+			w.truncated = true
+		}
+	}
+
+	segment := max(w.limit/2, 1)
+	for len(p) > 0 {
+		// fill segments of half the limit, each with whole records if framed
+		size := int64(len(p))
+		if w.framed {
+			size = min(size, logBuffer)
+		}
+		if truncating && w.framed {
+			size = min(size, max(segment-header, 1))
+			if w.size > 0 && w.size+header+size > segment {
+				if err := w.rotate(); err != nil {
+					return 0, err
+				}
+			}
+		} else if truncating {
+			if w.size >= segment {
+				if err := w.rotate(); err != nil {
+					return 0, err
+				}
+			}
+			size = min(size, segment-w.size)
+		}
+		out := p[:size]
+		if p = p[size:]; w.framed {
+			out = frame(at, stream, out)
+		}
+		if w.framed {
+			w.mark(at)
+		}
+		m, err := w.file.Write(out)
+		w.size += int64(m)
+		if err != nil {
+			return 0, fmt.Errorf("logs: %w", err)
+		}
+	}
+	// pretend written for the job to keep going
+	return n, nil
+}
+
+// rotate renames the log file as the older segment named by its offset,
+// dropping any before, and continues in a new log file
+func (w *logWriter) rotate() error {
+	path := w.file.Name()
+	older := segmentPath(path, w.base)
+	if err := os.Rename(path, older); err != nil {
+		return fmt.Errorf("rotate logs: %w", err)
+	}
+	// the index follows its segment only once renamed for readers to tell
+	if w.index != nil {
+		w.index.Close()
+		_ = os.Rename(path+indexSuffix, older+indexSuffix)
+		w.index = nil
+	}
+	if w.older != "" {
+		_ = os.Remove(w.older)
+		_ = os.Remove(w.older + indexSuffix)
+		w.truncated = true
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, logFileMode)
+	if err != nil {
+		return fmt.Errorf("rotate logs: %w", err)
+	}
+	// close the older segment only once replaced for its readers to follow
+	w.file.Close()
+	w.file, w.older = file, older
+	w.base, w.size, w.marked = w.base+w.size, 0, 0
+	return nil
+}
+
+// mark indexes the framed record about to be written at the time once at
+// least indexInterval bytes after the last one marked. The index only speeds
+// up seeking so any error writing it is ignored.
+func (w *logWriter) mark(at time.Time) {
+	if w.size-w.marked < indexInterval {
+		return
+	}
+	w.marked = w.size
+	if w.index == nil {
+		index, err := os.OpenFile(w.file.Name()+indexSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, logFileMode)
+		if err != nil {
+			return
+		}
+		w.index = index
+	}
+	var mark [indexMark]byte
+	binary.BigEndian.PutUint64(mark[:], uint64(w.size))
+	binary.BigEndian.PutUint64(mark[8:], uint64(at.UnixNano()))
+	_, _ = w.index.Write(mark[:])
+}
+
+// Written returns the bytes written by the job including those dropped
+func (w *logWriter) Written() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+// Truncated returns true once any output was dropped
+func (w *logWriter) Truncated() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.truncated
+}
+
+// Close closes the log file and its index
+func (w *logWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.index != nil {
+		w.index.Close()
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("logs: %w", err)
+	}
+	return nil
+}
+
+// frame returns the record of the output written to the stream at the time
+func frame(at time.Time, stream int, out []byte) []byte {
+	record := make([]byte, recordHeader+len(out))
+	binary.BigEndian.PutUint64(record, uint64(at.UnixNano()))
+	record[8] = byte(stream)
+	binary.BigEndian.PutUint32(record[9:], uint32(len(out)))
+	copy(record[recordHeader:], out)
+	return record
+}
+
+// Size returns the bytes of the record in framed logs
+func (r LogRecord) Size() int64 {
+	return recordHeader + int64(len(r.Out))
+}
+
+// NewLogRecordReader returns the LogRecordReader of the framed logs of r, e.g.
+// of Job.Logs
+func NewLogRecordReader(r io.Reader) *LogRecordReader {
+	return &LogRecordReader{r: r}
+}
+
+// Read returns the next LogRecord or io.EOF once no more, failing with
+// ErrLogRecord if its output is larger than any written
+func (r *LogRecordReader) Read() (LogRecord, error) {
+	if _, err := io.ReadFull(r.r, r.header[:]); err != nil {
+		return LogRecord{}, err
+	}
+	size := binary.BigEndian.Uint32(r.header[9:])
+	if size > logBuffer {
+		return LogRecord{}, fmt.Errorf("%w of %d bytes", ErrLogRecord, size)
+	}
+	out := make([]byte, size)
+	if _, err := io.ReadFull(r.r, out); err != nil {
+		return LogRecord{}, fmt.Errorf("log record: %w", io.ErrUnexpectedEOF)
+	}
+	return LogRecord{
+		Time:   time.Unix(0, int64(binary.BigEndian.Uint64(r.header[:]))),
+		Stream: int(r.header[8]),
+		Out:    out,
+	}, nil
+}
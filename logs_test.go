@@ -0,0 +1,117 @@
+package tjob_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob"
+)
+
+func TestParseLogPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in     string
+		policy string
+		err    error
+	}{
+		{"", tjob.LogTruncate, nil},
+		{"truncate", tjob.LogTruncate, nil},
+		{"stop", tjob.LogStop, nil},
+		{"kill", tjob.LogKill, nil},
+		{"rotate", "", tjob.ErrInvalidLogPolicy},
+	}
+	for _, test := range tests {
+		policy, err := tjob.ParseLogPolicy(test.in)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected err(%v) == %v", test.in, err, test.err)
+			continue
+		}
+		if policy != test.policy {
+			t.Errorf("%s: expected policy(%s) == %s", test.in, policy, test.policy)
+		}
+	}
+}
+
+func TestLogRecordReader(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	var logs bytes.Buffer
+	for i, out := range []string{"Hello", "World"} {
+		header := make([]byte, 13)
+		binary.BigEndian.PutUint64(header, uint64(now.UnixNano()))
+		header[8] = byte(tjob.Stdout + i)
+		binary.BigEndian.PutUint32(header[9:], uint32(len(out)))
+		logs.Write(append(header, out...))
+	}
+	logs.WriteString("torn")
+
+	sut := tjob.NewLogRecordReader(&logs)
+	for i, out := range []string{"Hello", "World"} {
+		record, err := sut.Read()
+		if err != nil {
+			t.Fatalf("unexpected read: %v", err)
+		}
+		if string(record.Out) != out || record.Stream != tjob.Stdout+i || !record.Time.Equal(now) {
+			t.Errorf("unexpected record: %+v", record)
+		}
+	}
+	if _, err := sut.Read(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected err(%v) == %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestLogRecordReaderTooLarge(t *testing.T) {
+	t.Parallel()
+
+	// torn or corrupt header of a record larger than any written
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[9:], 1<<31)
+
+	sut := tjob.NewLogRecordReader(bytes.NewReader(header))
+	if _, err := sut.Read(); !errors.Is(err, tjob.ErrLogRecord) {
+		t.Errorf("expected err(%v) == %v", err, tjob.ErrLogRecord)
+	}
+}
+
+func TestLogWriterFramed(t *testing.T) {
+	t.Parallel()
+
+	file, err := os.CreateTemp(t.TempDir(), "output.log")
+	if err != nil {
+		t.Fatalf("unexpected temp: %v", err)
+	}
+	defer file.Close()
+
+	// output written at once beyond the most of a record
+	out := bytes.Repeat([]byte("a"), 100*1024)
+	sut := tjob.NewLogWriter(file, true)
+	if n, err := sut.Write(out); err != nil || n != len(out) {
+		t.Fatalf("unexpected write of %d bytes: %v", n, err)
+	}
+
+	_, _ = file.Seek(0, io.SeekStart)
+	records := tjob.NewLogRecordReader(file)
+	var read []byte
+	for {
+		record, err := records.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("unexpected read: %v", err)
+		}
+		if len(record.Out) > 32*1024 {
+			t.Errorf("expected record of %d bytes <= %d", len(record.Out), 32*1024)
+		}
+		read = append(read, record.Out...)
+	}
+	if !bytes.Equal(read, out) {
+		t.Errorf("expected %d bytes read == %d written", len(read), len(out))
+	}
+}
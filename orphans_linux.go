@@ -0,0 +1,133 @@
+package tjob
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// prefix of the cgroups and log files of jobs
+	orphanPrefix = "tjob-"
+	logSuffix    = ".log"
+	// most time to wait for the processes of orphaned cgroups to die
+	orphanKillTimeout = 5 * time.Second
+	orphanKillPoll    = 100 * time.Millisecond
+)
+
+// Orphans cleaned up since no job references them anymore
+type Orphans struct {
+	// Cgroups removed after killing their processes
+	Cgroups []string
+
+	// Killed processes left running in the cgroups
+	Killed int
+
+	// Logs removed with their exit status files
+	Logs []string
+}
+
+// CleanOrphans kills the processes left in the cgroups of all jobs except ids,
+// e.g. after a crash, and removes those cgroups as well as the log files in
+// os.TempDir() and each Job.LogDir of logDirs except logPaths. Any error stops
+// at the cgroup or log affected.
+func CleanOrphans(ids, logPaths []string, logDirs ...string) (Orphans, error) {
+	out, err := cleanCgroups(ids)
+	logs, lerr := cleanLogs(logPaths, logDirs...)
+	out.Logs = logs
+	return out, errors.Join(err, lerr)
+}
+
+// cleanCgroups kills the processes left in the cgroups of all jobs except ids
+// and removes those cgroups
+func cleanCgroups(ids []string) (Orphans, error) {
+	var (
+		out  Orphans
+		errs []error
+	)
+	cgroups, err := filepath.Glob(cgroupOf("*"))
+	if err != nil {
+		return out, fmt.Errorf("orphans: %w", err)
+	}
+	for _, cgroup := range cgroups {
+		id := strings.TrimPrefix(filepath.Base(cgroup), orphanPrefix)
+		if slices.Contains(ids, id) {
+			continue
+		}
+		killed, err := removeCgroup(cgroup)
+		out.Killed += killed
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		out.Cgroups = append(out.Cgroups, cgroup)
+	}
+	return out, errors.Join(errs...)
+}
+
+// cleanLogs removes the log files in os.TempDir() and each of logDirs except
+// logPaths, with their segments and exit status files
+func cleanLogs(logPaths []string, logDirs ...string) ([]string, error) {
+	var (
+		out  []string
+		errs []error
+	)
+	logs, err := filepath.Glob(filepath.Join(os.TempDir(), orphanPrefix+"*"+logSuffix))
+	if err != nil {
+		return out, fmt.Errorf("orphans: %w", err)
+	}
+	for _, dir := range logDirs {
+		found, err := filepath.Glob(filepath.Join(dir, "*", logName))
+		if err != nil {
+			return out, fmt.Errorf("orphans: %w", err)
+		}
+		logs = append(logs, found...)
+	}
+	for _, path := range logs {
+		if slices.Contains(logPaths, path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, fmt.Errorf("orphans: %w", err))
+			continue
+		}
+		removeOlder(path)
+		_ = os.Remove(path + exitSuffix)
+		if filepath.Base(path) == logName {
+			_ = os.Remove(filepath.Dir(path))
+		}
+		out = append(out, path)
+	}
+	return out, errors.Join(errs...)
+}
+
+// removeCgroup kills all processes of the cgroup and removes it once empty
+func removeCgroup(cgroup string) (int, error) {
+	data, err := os.ReadFile(cgroup + "/cgroup.procs")
+	if err != nil {
+		return 0, fmt.Errorf("orphans: %w", err)
+	}
+	pids := strings.Fields(string(data))
+	for _, p := range pids {
+		if pid, err := strconv.Atoi(p); err == nil {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+	// wait for the processes to die since a cgroup in use cannot be removed
+	deadline := time.Now().Add(orphanKillTimeout)
+	for populated(cgroup) && time.Now().Before(deadline) {
+		time.Sleep(orphanKillPoll)
+	}
+	if err := unix.Rmdir(cgroup); err != nil {
+		return len(pids), fmt.Errorf("orphans %s: %w", cgroup, err)
+	}
+	return len(pids), nil
+}
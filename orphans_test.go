@@ -0,0 +1,74 @@
+package tjob_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/neildo/tjob"
+)
+
+func TestCleanLogs(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	// logs of users a and b with those of job 2 still referenced
+	dir := t.TempDir()
+	files := []string{
+		"a/1/output.log",
+		"a/1/output.log.100",
+		"a/1/output.log.exit",
+		"a/2/output.log",
+		"a/2/output.log.exit",
+		"b/3/output.log",
+		"b/3/notes.txt",
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("unexpected dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("Hello"), 0o600); err != nil {
+			t.Fatalf("unexpected file: %v", err)
+		}
+	}
+	// temporary logs of jobs without log dir
+	for _, file := range []string{"tjob-4.log", "tjob-5.log", "other.log"} {
+		if err := os.WriteFile(filepath.Join(tmp, file), []byte("Hello"), 0o600); err != nil {
+			t.Fatalf("unexpected file: %v", err)
+		}
+	}
+
+	keep := []string{filepath.Join(dir, "a/2/output.log"), filepath.Join(tmp, "tjob-5.log")}
+	logs, err := tjob.CleanLogs(keep, filepath.Join(dir, "a"), filepath.Join(dir, "b"))
+	if err != nil {
+		t.Fatalf("unexpected clean: %v", err)
+	}
+	cleaned := []string{
+		filepath.Join(tmp, "tjob-4.log"),
+		filepath.Join(dir, "a/1/output.log"),
+		filepath.Join(dir, "b/3/output.log"),
+	}
+	if !slices.Equal(logs, cleaned) {
+		t.Errorf("expected cleaned(%v) == %v", logs, cleaned)
+	}
+
+	tests := []struct {
+		path   string
+		exists bool
+	}{
+		{filepath.Join(dir, "a/1"), false},
+		{filepath.Join(dir, "a/2/output.log"), true},
+		{filepath.Join(dir, "a/2/output.log.exit"), true},
+		// never removes files other than logs
+		{filepath.Join(dir, "b/3/notes.txt"), true},
+		{filepath.Join(tmp, "tjob-5.log"), true},
+		{filepath.Join(tmp, "other.log"), true},
+	}
+	for _, test := range tests {
+		if _, err := os.Stat(test.path); (err == nil) != test.exists {
+			t.Errorf("%s: expected exists == %t: %v", test.path, test.exists, err)
+		}
+	}
+}
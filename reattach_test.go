@@ -0,0 +1,85 @@
+package tjob_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob"
+)
+
+// env var of the test binary re-executed as the daemon starting the job
+const daemonEnv = "TJOB_TEST_DAEMON"
+
+// TestReattachWhileWriting restarts the daemon of a job writing its logs with
+// the default log limit and format for the job to keep writing once reattached
+func TestReattachWhileWriting(t *testing.T) {
+	if dir := os.Getenv(daemonEnv); dir != "" {
+		daemon(dir)
+		return
+	}
+	initPath := requireJail(t)
+
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestReattachWhileWriting$")
+	cmd.Env = append(os.Environ(), daemonEnv+"="+dir, "TJOB_TEST_INIT="+initPath)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("unexpected pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("unexpected daemon: %v", err)
+	}
+	line, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		_ = cmd.Process.Kill()
+		t.Fatalf("unexpected job: %v", err)
+	}
+	var (
+		id, logPath string
+		pid         int
+	)
+	if _, err := fmt.Sscan(line, &id, &logPath, &pid); err != nil {
+		_ = cmd.Process.Kill()
+		t.Fatalf("unexpected job %q: %v", line, err)
+	}
+	sut := tjob.ReattachJob(id, tjob.Status{Pid: pid, StartedAt: time.Now()}, logPath)
+	defer func() {
+		_ = sut.Stop()
+		_ = sut.Wait()
+	}()
+
+	// daemon dies while the job writes
+	time.Sleep(200 * time.Millisecond)
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+	before := sut.LogSize()
+	time.Sleep(500 * time.Millisecond)
+	if after := sut.LogSize(); after <= before {
+		t.Errorf("expected logs(%d) > %d once daemon restarted", after, before)
+	}
+	if sut.Done() {
+		t.Errorf("expected job running: %+v", sut.Status())
+	}
+}
+
+// daemon starts the job writing logs in dir and prints its id, log path and
+// pid until killed
+func daemon(dir string) {
+	job := tjob.NewJob("sh", "-c", "while :; do echo hello; sleep 0.01; done")
+	job.InitPath = os.Getenv("TJOB_TEST_INIT")
+	job.Mnt = os.Getenv(mntEnv)
+	job.MemoryMB = 64
+	job.LogDir = dir
+	if err := job.Start(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	status := job.Status()
+	fmt.Println(job.Id, job.LogPath(), status.Pid)
+	select {}
+}
@@ -0,0 +1,109 @@
+package tjob
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// restart modes
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+const (
+	// default initial backoff between attempts
+	restartDelay = time.Second
+	// default max backoff between attempts
+	restartMaxDelay = time.Minute
+	// most attempts kept in the exit history, dropping the oldest
+	maxAttempts = 16
+)
+
+var ErrInvalidRestart = errors.New("invalid restart policy")
+
+type (
+	// RestartPolicy decides whether to start the job again once it exits
+	RestartPolicy struct {
+		// Mode is one of never (default), on-failure, or always
+		Mode string
+
+		// MaxRetries limits the restarts on-failure unless zero
+		MaxRetries int
+
+		// Delay is the initial backoff unless zero for the default
+		Delay time.Duration
+
+		// MaxDelay caps the exponential backoff unless zero for the default
+		MaxDelay time.Duration
+	}
+
+	// Attempt is the exit history of a single run of the job
+	Attempt struct {
+		Pid       int
+		StartedAt time.Time
+		StoppedAt time.Time
+		Exit      int32 // exit code
+	}
+)
+
+// ParseRestartPolicy parses never, on-failure[:max-retries], or always
+func ParseRestartPolicy(s string) (RestartPolicy, error) {
+	mode, retries, found := strings.Cut(s, ":")
+	policy := RestartPolicy{Mode: mode}
+	switch mode {
+	case "", RestartNever, RestartAlways:
+		if found {
+			return policy, fmt.Errorf("%w: %s", ErrInvalidRestart, s)
+		}
+	case RestartOnFailure:
+		if !found {
+			break
+		}
+		n, err := strconv.Atoi(retries)
+		if err != nil || n < 0 {
+			return policy, fmt.Errorf("%w: %s", ErrInvalidRestart, s)
+		}
+		policy.MaxRetries = n
+	default:
+		return policy, fmt.Errorf("%w: %s", ErrInvalidRestart, s)
+	}
+	return policy, nil
+}
+
+// Retry returns true if the job exiting with the exit code after the given
+// restarts should start again
+func (p RestartPolicy) Retry(exit int32, restarts int) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return exit != 0 && (p.MaxRetries == 0 || restarts < p.MaxRetries)
+	default:
+		return false
+	}
+}
+
+// Backoff returns the exponential delay with jitter before the given restart
+func (p RestartPolicy) Backoff(restarts int) time.Duration {
+	delay, limit := p.Delay, p.MaxDelay
+	if delay <= 0 {
+		delay = restartDelay
+	}
+	if limit <= 0 {
+		limit = restartMaxDelay
+	}
+	for i := 0; i < restarts && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+
+	// equal jitter keeps at least half of the delay
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
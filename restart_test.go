@@ -0,0 +1,131 @@
+package tjob_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neildo/tjob"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		mode string
+		max  int
+		err  error
+	}{
+		{"", "", 0, nil},
+		{"never", tjob.RestartNever, 0, nil},
+		{"always", tjob.RestartAlways, 0, nil},
+		{"on-failure", tjob.RestartOnFailure, 0, nil},
+		{"on-failure:5", tjob.RestartOnFailure, 5, nil},
+		{"on-failure:-1", "", 0, tjob.ErrInvalidRestart},
+		{"always:5", "", 0, tjob.ErrInvalidRestart},
+		{"sometimes", "", 0, tjob.ErrInvalidRestart},
+	}
+	for _, test := range tests {
+		policy, err := tjob.ParseRestartPolicy(test.in)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected err(%v) == %v", test.in, err, test.err)
+			continue
+		}
+		if err == nil && (policy.Mode != test.mode || policy.MaxRetries != test.max) {
+			t.Errorf("%s: expected %+v", test.in, policy)
+		}
+	}
+}
+
+func TestRestartPolicyRetry(t *testing.T) {
+	t.Parallel()
+
+	onFailure := tjob.RestartPolicy{Mode: tjob.RestartOnFailure, MaxRetries: 2}
+	if onFailure.Retry(0, 0) {
+		t.Error("expected no retry on success")
+	}
+	if !onFailure.Retry(1, 1) {
+		t.Error("expected retry on failure")
+	}
+	if onFailure.Retry(1, 2) {
+		t.Error("expected no retry after max retries")
+	}
+	if !(tjob.RestartPolicy{Mode: tjob.RestartAlways}).Retry(0, 100) {
+		t.Error("expected retry always")
+	}
+	if (tjob.RestartPolicy{}).Retry(1, 0) {
+		t.Error("expected never retry by default")
+	}
+}
+
+func TestRestartPolicyBackoff(t *testing.T) {
+	t.Parallel()
+
+	policy := tjob.RestartPolicy{Delay: time.Second, MaxDelay: 8 * time.Second}
+	for restarts, limit := range []time.Duration{1, 2, 4, 8, 8, 8} {
+		limit *= time.Second
+		delay := policy.Backoff(restarts)
+		if delay < limit/2 || delay > limit {
+			t.Errorf("restart %d: expected %s <= delay(%s) <= %s", restarts, limit/2, delay, limit)
+		}
+	}
+}
+
+func TestJobAttemptsCapped(t *testing.T) {
+	initPath := requireJail(t)
+
+	// crash loop restarting right away
+	sut := jailed(t, initPath, "sh", "-c", "exit 1")
+	sut.Restart = tjob.RestartPolicy{Mode: tjob.RestartAlways, Delay: time.Millisecond, MaxDelay: time.Millisecond}
+	if err := sut.Start(context.Background()); err != nil {
+		t.Fatalf("unexpected start: %v", err)
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for sut.Status().Restarts < 20 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = sut.Stop()
+	_ = sut.Wait()
+
+	status := sut.Status()
+	if status.Restarts < 20 {
+		t.Fatalf("expected restarts(%d) >= 20", status.Restarts)
+	}
+	// only the last attempts in order
+	if n := len(status.Attempts); n != 16 {
+		t.Errorf("expected attempts(%d) == 16 of %d restarts", n, status.Restarts)
+	}
+	for i := 1; i < len(status.Attempts); i++ {
+		if status.Attempts[i].StartedAt.Before(status.Attempts[i-1].StoppedAt) {
+			t.Errorf("expected attempt %d after %d: %+v", i, i-1, status.Attempts)
+		}
+	}
+	if last := status.Attempts[len(status.Attempts)-1]; last.StoppedAt.After(status.StoppedAt) {
+		t.Errorf("expected last attempt(%v) stopped by %v", last.StoppedAt, status.StoppedAt)
+	}
+}
+
+func TestJobTimeoutWithoutBackoff(t *testing.T) {
+	initPath := requireJail(t)
+
+	// backing off longer than the timeouts between silent attempts
+	sut := jailed(t, initPath, "sh", "-c", "sleep 0.3; exit 1")
+	sut.Restart = tjob.RestartPolicy{Mode: tjob.RestartAlways, Delay: 2 * time.Second, MaxDelay: 2 * time.Second}
+	sut.Timeout = time.Second
+	sut.IdleTimeout = 700 * time.Millisecond
+	if err := sut.Start(context.Background()); err != nil {
+		t.Fatalf("unexpected start: %v", err)
+	}
+	_ = sut.Wait()
+
+	// timed out only once the attempts ran for the timeout
+	status := sut.Status()
+	if !errors.Is(status.Error, tjob.ErrTimedOut) || errors.Is(status.Error, tjob.ErrIdleTimedOut) {
+		t.Errorf("expected err(%v) == %v", status.Error, tjob.ErrTimedOut)
+	}
+	if status.Restarts < 2 {
+		t.Errorf("expected restarts(%d) >= 2", status.Restarts)
+	}
+}
@@ -0,0 +1,379 @@
+package tjob
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNotFramed = errors.New("not framed")
+
+type (
+	// LogOptions selects the logs returned by Job.LogsWith
+	LogOptions struct {
+		// Follow waits for more logs until the job stops instead of EOF at
+		// the end of the logs so far
+		Follow bool
+
+		// Offset in all logs ever written to start at unless dropped since
+		Offset int64
+
+		// Tail starts at the last lines unless zero
+		Tail int
+
+		// Since starts at the logs written since unless zero, framed only
+		Since time.Time
+	}
+
+	// segment of the logs starting at base in all logs ever written
+	segment struct {
+		path string
+		base int64
+		info os.FileInfo
+	}
+
+	// mark of the offset in the segment and time of a framed record indexed
+	mark struct {
+		offset int64
+		at     time.Time
+	}
+)
+
+// segmentPath returns the path of the older segment of the logs at path
+// rotated at the offset
+func segmentPath(path string, base int64) string {
+	return fmt.Sprintf("%s.%d", path, base)
+}
+
+// segmentsOf returns the segments of the logs at path in order: any older
+// rotated ones named by their offset and then the latest at path
+func segmentsOf(path string) []segment {
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	var segments []segment
+	prefix := filepath.Base(path) + "."
+	for _, entry := range entries {
+		suffix, found := strings.CutPrefix(entry.Name(), prefix)
+		if !found {
+			continue
+		}
+		base, err := strconv.ParseInt(suffix, 10, 64)
+		if err != nil {
+			continue
+		}
+		older := filepath.Join(filepath.Dir(path), entry.Name())
+		if info, err := os.Stat(older); err == nil {
+			segments = append(segments, segment{path: older, base: base, info: info})
+		}
+	}
+	slices.SortFunc(segments, func(a, b segment) int { return cmp.Compare(a.base, b.base) })
+
+	// the latest continues after the older segment just before
+	info, err := os.Stat(path)
+	if err != nil {
+		return segments
+	}
+	var base int64
+	if len(segments) > 0 {
+		base = segments[len(segments)-1].end()
+	}
+	return append(segments, segment{path: path, base: base, info: info})
+}
+
+// removeOlder removes the older segments of the logs at path and the index
+// of each segment
+func removeOlder(path string) {
+	for _, s := range segmentsOf(path) {
+		if s.path != path {
+			_ = os.Remove(s.path)
+		}
+		_ = os.Remove(s.path + indexSuffix)
+	}
+	_ = os.Remove(path + indexSuffix)
+}
+
+// end returns the offset after the segment
+func (s segment) end() int64 {
+	return s.base + s.info.Size()
+}
+
+// open opens the segment unless rotated meanwhile
+func (s segment) open() (*os.File, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err != nil || !os.SameFile(info, s.info) {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", s.path, os.ErrNotExist)
+	}
+	return file, nil
+}
+
+// marks returns the records indexed in the segment in order, or none if
+// indexed in another segment rotated meanwhile
+func (s segment) marks() []mark {
+	data, err := os.ReadFile(s.path + indexSuffix)
+	if err != nil {
+		return nil
+	}
+	// the index of the latest segment is renamed only after the segment
+	if info, err := os.Stat(s.path); err != nil || !os.SameFile(info, s.info) {
+		return nil
+	}
+	var marks []mark
+	for ; len(data) >= indexMark; data = data[indexMark:] {
+		offset := int64(binary.BigEndian.Uint64(data))
+		if offset <= 0 || offset >= s.info.Size() || (len(marks) > 0 && offset <= marks[len(marks)-1].offset) {
+			break
+		}
+		marks = append(marks, mark{offset: offset, at: time.Unix(0, int64(binary.BigEndian.Uint64(data[8:])))})
+	}
+	return marks
+}
+
+// before returns the offset in the segment of the record marked before the
+// first of the marks matching, or of the first record if none before
+func before(marks []mark, match func(mark) bool) int64 {
+	if i := sort.Search(len(marks), func(i int) bool { return match(marks[i]) }); i > 0 {
+		return marks[i-1].offset
+	}
+	return 0
+}
+
+// scan calls fn with the offset, time, stream and size of the output of each
+// framed record of the segment from the one at offset from until fn returns
+// false, failing with ErrLogRecord at any record larger than written
+func (s segment) scan(from int64, fn func(offset int64, at time.Time, stream, size int) bool) error {
+	file, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, from, s.info.Size()-from), logBuffer)
+	var header [recordHeader]byte
+	for offset := from; ; {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return fmt.Errorf("scan logs: %w", err)
+		}
+		size := int(binary.BigEndian.Uint32(header[9:]))
+		if size > logBuffer {
+			return fmt.Errorf("scan logs: %w of %d bytes at %d", ErrLogRecord, size, s.base+offset)
+		}
+		at := time.Unix(0, int64(binary.BigEndian.Uint64(header[:])))
+		if !fn(s.base+offset, at, int(header[8]), size) {
+			return nil
+		}
+		if _, err := reader.Discard(size); err != nil {
+			// torn by the end of the segment
+			return nil
+		}
+		offset += recordHeader + int64(size)
+	}
+}
+
+// startOf returns the offset in the segments to start reading at per opts.
+// Any pending record of framed logs is to read first before the offset.
+func startOf(segments []segment, framed bool, opts LogOptions) (int64, []byte, error) {
+	if len(segments) == 0 {
+		return 0, nil, nil
+	}
+	start := max(opts.Offset, segments[0].base)
+	if framed && start > segments[0].base {
+		start = recordAt(segments, start)
+	}
+	if !opts.Since.IsZero() {
+		if !framed {
+			return 0, nil, fmt.Errorf("since: %w", ErrNotFramed)
+		}
+		start = max(start, recordSince(segments, opts.Since))
+	}
+	if opts.Tail <= 0 {
+		return start, nil, nil
+	}
+	tail, pending, err := tailOf(segments, framed, opts.Tail)
+	if err != nil || tail < start {
+		return start, nil, err
+	}
+	return tail, pending, nil
+}
+
+// recordAt returns the offset of the first framed record at or after offset
+func recordAt(segments []segment, offset int64) int64 {
+	for _, s := range segments {
+		if offset >= s.end() {
+			continue
+		}
+		at := s.end()
+		from := before(s.marks(), func(m mark) bool { return s.base+m.offset > offset })
+		_ = s.scan(from, func(o int64, _ time.Time, _, _ int) bool {
+			if o >= offset {
+				at = o
+				return false
+			}
+			return true
+		})
+		return at
+	}
+	return segments[len(segments)-1].end()
+}
+
+// recordSince returns the offset of the first framed record written since
+func recordSince(segments []segment, since time.Time) int64 {
+	for _, s := range segments {
+		at := int64(-1)
+		from := before(s.marks(), func(m mark) bool { return !m.at.Before(since) })
+		_ = s.scan(from, func(o int64, t time.Time, _, _ int) bool {
+			if !t.Before(since) {
+				at = o
+				return false
+			}
+			return true
+		})
+		if at >= 0 {
+			return at
+		}
+	}
+	return segments[len(segments)-1].end()
+}
+
+// tailOf returns the offset of the last lines of the segments. With framed
+// logs, the offset is after the record with the first of the lines while the
+// pending record has its output from that line on.
+func tailOf(segments []segment, framed bool, lines int) (int64, []byte, error) {
+	counter := lineCounter{lines: lines}
+	for i := len(segments) - 1; i >= 0; i-- {
+		s := segments[i]
+		if !framed {
+			offset, err := counter.raw(s)
+			if err != nil || offset >= 0 {
+				return offset, nil, err
+			}
+			continue
+		}
+		offset, pending, err := counter.framed(s)
+		if err != nil || offset >= 0 {
+			return offset, pending, err
+		}
+	}
+	return segments[0].base, nil, nil
+}
+
+// lineCounter counts the lines backwards from the end of the logs
+type lineCounter struct {
+	lines int
+	seen  int
+	// the last line ending the logs with a newline counts once
+	started bool
+}
+
+// count returns the index after the newline starting the last of the lines in
+// the output read backwards, or -1 if none
+func (c *lineCounter) count(out []byte) int {
+	for i := len(out) - 1; i >= 0; i-- {
+		if out[i] != '\n' {
+			c.started = true
+			continue
+		}
+		if !c.started {
+			c.started = true
+			continue
+		}
+		if c.seen++; c.seen == c.lines {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// raw returns the offset of the last lines in the raw segment or -1 if before
+func (c *lineCounter) raw(s segment) (int64, error) {
+	file, err := s.open()
+	if err != nil {
+		return -1, err
+	}
+	defer file.Close()
+
+	buffer := make([]byte, logBuffer)
+	for end := s.info.Size(); end > 0; {
+		n := min(int64(len(buffer)), end)
+		end -= n
+		if _, err := file.ReadAt(buffer[:n], end); err != nil && !errors.Is(err, io.EOF) {
+			return -1, fmt.Errorf("tail logs: %w", err)
+		}
+		if i := c.count(buffer[:n]); i >= 0 {
+			return s.base + end + int64(i), nil
+		}
+	}
+	return -1, nil
+}
+
+// framed returns the offset after the record of the last lines in the framed
+// segment with the output of that record pending from the first of the lines,
+// or -1 if before. It reads the records backwards one block between marks of
+// the index at a time.
+func (c *lineCounter) framed(s segment) (int64, []byte, error) {
+	type record struct {
+		offset int64
+		at     time.Time
+		stream int
+		size   int
+	}
+	file, err := s.open()
+	if err != nil {
+		return -1, nil, err
+	}
+	defer file.Close()
+
+	starts := []int64{0}
+	for _, m := range s.marks() {
+		starts = append(starts, m.offset)
+	}
+	for b := len(starts) - 1; b >= 0; b-- {
+		to := s.info.Size()
+		if b+1 < len(starts) {
+			to = starts[b+1]
+		}
+		var records []record
+		if err := s.scan(starts[b], func(o int64, t time.Time, stream, size int) bool {
+			if o-s.base >= to {
+				return false
+			}
+			records = append(records, record{o, t, stream, size})
+			return true
+		}); err != nil {
+			return -1, nil, err
+		}
+		for i := len(records) - 1; i >= 0; i-- {
+			r := records[i]
+			out := make([]byte, r.size)
+			if _, err := file.ReadAt(out, r.offset-s.base+recordHeader); err != nil && !errors.Is(err, io.EOF) {
+				return -1, nil, fmt.Errorf("tail logs: %w", err)
+			}
+			at := c.count(out)
+			switch {
+			case at < 0:
+				continue
+			case at == len(out):
+				// the lines start at the next record
+				return r.offset + recordHeader + int64(r.size), nil, nil
+			default:
+				return r.offset + recordHeader + int64(r.size), frame(r.at, r.stream, out[at:]), nil
+			}
+		}
+	}
+	return -1, nil, nil
+}
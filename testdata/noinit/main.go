@@ -0,0 +1,12 @@
+// noinit imports tjob without ever calling tjob.Init() to run as a jail
+package main
+
+import (
+	"fmt"
+
+	_ "github.com/neildo/tjob"
+)
+
+func main() {
+	fmt.Println("main")
+}